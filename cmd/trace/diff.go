@@ -0,0 +1,540 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type DiffKind string
+
+const (
+	DiffSame    DiffKind = "same"
+	DiffAdded   DiffKind = "added"
+	DiffRemoved DiffKind = "removed"
+	DiffChanged DiffKind = "changed"
+)
+
+// DiffNode pairs a call of the old trace with
+// the aligned call of the new trace.
+// Old is nil for added calls, New is nil for removed calls.
+type DiffNode struct {
+	Kind    DiffKind
+	Old     *StackExport
+	New     *StackExport
+	Changes []*Change
+
+	Children []*DiffNode
+
+	// whether this node or any descendant differs
+	hasDiff bool
+}
+
+type Change struct {
+	Field string // Args,Results,Error,Panic,Cost
+	Old   string
+	New   string
+}
+
+type DiffOptions struct {
+	// a call is reported as slower when its new cost
+	// exceeds old cost by this ratio, 0 means no timing check
+	CostRatio float64
+}
+
+type DiffStat struct {
+	Added   int
+	Removed int
+	Changed int
+}
+
+const defaultCostRatio = 1.5
+
+const diffHelp = `
+Usage:
+    xgo tool trace diff [--html] [--cost-ratio=R] [flags] <old.json> <new.json>
+
+Compare two traces, calls are aligned by their package and
+function identity. Added, removed and changed calls are printed.
+Calls whose cost grew by more than R times(default 1.5) are reported
+as timing regressions, set R to 0 to disable.
+
+Options:
+    --html            serve the diff as a web page instead of printing text
+    --cost-ratio=R    timing regression ratio
+
+With --html, flags of 'xgo tool trace' like --port, --no-open
+and --export are also accepted.
+
+Exit status is 1 if there are differences.
+`
+
+func handleDiff(args []string) {
+	var files []string
+	var useHTML bool
+	opts := &DiffOptions{CostRatio: defaultCostRatio}
+	serveOpts := &serveOptions{port: defaultPort}
+	n := len(args)
+	for i := 0; i < n; i++ {
+		arg := args[i]
+		if arg == "-h" || arg == "--help" {
+			fmt.Print(strings.TrimPrefix(diffHelp, "\n"))
+			return
+		}
+		if arg == "--html" {
+			useHTML = true
+			continue
+		}
+		if arg == "--cost-ratio" || strings.HasPrefix(arg, "--cost-ratio=") {
+			var val string
+			if arg == "--cost-ratio" {
+				if i+1 >= n {
+					exitf("--cost-ratio requires value")
+				}
+				val = args[i+1]
+				i++
+			} else {
+				val = strings.TrimPrefix(arg, "--cost-ratio=")
+			}
+			ratio, err := strconv.ParseFloat(val, 64)
+			if err != nil {
+				exitf("bad --cost-ratio: %v", err)
+			}
+			opts.CostRatio = ratio
+			continue
+		}
+		consumed, err := parseServeFlag(args, i, serveOpts)
+		if err != nil {
+			exitf("%v", err)
+		}
+		if consumed > 0 {
+			i += consumed - 1
+			continue
+		}
+		if strings.HasPrefix(arg, "-") {
+			exitf("unrecognized flag: %s", arg)
+		}
+		files = append(files, arg)
+	}
+	if len(files) != 2 {
+		exitf("diff requires 2 files, see 'xgo tool trace diff --help'")
+	}
+	oldRoot, err := parseRecord(files[0])
+	if err != nil {
+		exitf("%s: %v", files[0], err)
+	}
+	newRoot, err := parseRecord(files[1])
+	if err != nil {
+		exitf("%s: %v", files[1], err)
+	}
+	diff := diffRoots(oldRoot, newRoot, opts)
+	if useHTML {
+		serve(func(w io.Writer) error {
+			renderDiffHTML(diff, files[0], files[1], w)
+			return nil
+		}, serveOpts)
+		return
+	}
+	stat := writeDiffText(os.Stdout, diff)
+	if stat.Added+stat.Removed+stat.Changed > 0 {
+		os.Exit(1)
+	}
+}
+
+func exitf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
+
+func diffRoots(oldRoot *RootExport, newRoot *RootExport, opts *DiffOptions) *DiffNode {
+	var oldChildren, newChildren []*StackExport
+	if oldRoot != nil {
+		oldChildren = oldRoot.Children
+	}
+	if newRoot != nil {
+		newChildren = newRoot.Children
+	}
+	root := &DiffNode{
+		Kind: DiffSame,
+		Old:  &StackExport{FuncInfo: &FuncInfoExport{IdentityName: "<root>"}},
+		New:  &StackExport{FuncInfo: &FuncInfoExport{IdentityName: "<root>"}},
+	}
+	root.Children = diffStacks(oldChildren, newChildren, opts)
+	root.hasDiff = anyDiff(root.Children)
+	return root
+}
+
+// lists whose LCS table would exceed this many cells
+// are aligned greedily, e.g. calls made in a big loop
+var maxLCSCells = 4 * 1024 * 1024
+
+// diffStacks aligns two lists of calls by the longest
+// common subsequence of their function identities
+func diffStacks(oldList []*StackExport, newList []*StackExport, opts *DiffOptions) []*DiffNode {
+	n, m := len(oldList), len(newList)
+	if n*m > maxLCSCells {
+		return diffStacksGreedy(oldList, newList, opts)
+	}
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if funcKey(oldList[i]) == funcKey(newList[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var nodes []*DiffNode
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && funcKey(oldList[i]) == funcKey(newList[j]):
+			nodes = append(nodes, diffStack(oldList[i], newList[j], opts))
+			i++
+			j++
+		case j >= m || (i < n && lcs[i+1][j] >= lcs[i][j+1]):
+			nodes = append(nodes, onlySide(DiffRemoved, oldList[i]))
+			i++
+		default:
+			nodes = append(nodes, onlySide(DiffAdded, newList[j]))
+			j++
+		}
+	}
+	return nodes
+}
+
+// diffStacksGreedy pairs each old call with the next
+// new call having the same identity, new calls skipped
+// over are added. It takes linear memory, but may
+// report more differences than diffStacks.
+func diffStacksGreedy(oldList []*StackExport, newList []*StackExport, opts *DiffOptions) []*DiffNode {
+	// positions of each key in newList, in order
+	positions := make(map[string][]int)
+	for j, stack := range newList {
+		key := funcKey(stack)
+		positions[key] = append(positions[key], j)
+	}
+	var nodes []*DiffNode
+	j := 0
+	for _, oldStack := range oldList {
+		key := funcKey(oldStack)
+		pos := positions[key]
+		for len(pos) > 0 && pos[0] < j {
+			pos = pos[1:]
+		}
+		positions[key] = pos
+		if len(pos) == 0 {
+			nodes = append(nodes, onlySide(DiffRemoved, oldStack))
+			continue
+		}
+		for ; j < pos[0]; j++ {
+			nodes = append(nodes, onlySide(DiffAdded, newList[j]))
+		}
+		nodes = append(nodes, diffStack(oldStack, newList[j], opts))
+		j++
+	}
+	for ; j < len(newList); j++ {
+		nodes = append(nodes, onlySide(DiffAdded, newList[j]))
+	}
+	return nodes
+}
+
+func diffStack(oldStack *StackExport, newStack *StackExport, opts *DiffOptions) *DiffNode {
+	node := &DiffNode{
+		Kind: DiffSame,
+		Old:  oldStack,
+		New:  newStack,
+	}
+	addChange := func(field string, oldVal string, newVal string) {
+		node.Changes = append(node.Changes, &Change{Field: field, Old: oldVal, New: newVal})
+	}
+	if oldArgs, newArgs := formatJSON(oldStack.Args), formatJSON(newStack.Args); oldArgs != newArgs {
+		addChange("Args", oldArgs, newArgs)
+	}
+	if oldRes, newRes := formatJSON(oldStack.Results), formatJSON(newStack.Results); oldRes != newRes {
+		addChange("Results", oldRes, newRes)
+	}
+	if oldStack.Error != newStack.Error {
+		addChange("Error", oldStack.Error, newStack.Error)
+	}
+	if oldStack.Panic != newStack.Panic {
+		addChange("Panic", strconv.FormatBool(oldStack.Panic), strconv.FormatBool(newStack.Panic))
+	}
+	if opts != nil && opts.CostRatio > 0 {
+		oldCost := oldStack.End - oldStack.Begin
+		newCost := newStack.End - newStack.Begin
+		if oldCost > 0 && float64(newCost) > float64(oldCost)*opts.CostRatio {
+			addChange("Cost", formatCost(oldStack.Begin, oldStack.End), formatCost(newStack.Begin, newStack.End)+fmt.Sprintf(" (%.1fx)", float64(newCost)/float64(oldCost)))
+		}
+	}
+	if len(node.Changes) > 0 {
+		node.Kind = DiffChanged
+	}
+	node.Children = diffStacks(oldStack.Children, newStack.Children, opts)
+	node.hasDiff = node.Kind != DiffSame || anyDiff(node.Children)
+	return node
+}
+
+// onlySide marks the whole subtree as added or removed
+func onlySide(kind DiffKind, stack *StackExport) *DiffNode {
+	node := &DiffNode{
+		Kind:    kind,
+		hasDiff: true,
+	}
+	if kind == DiffAdded {
+		node.New = stack
+	} else {
+		node.Old = stack
+	}
+	for _, child := range stack.Children {
+		node.Children = append(node.Children, onlySide(kind, child))
+	}
+	return node
+}
+
+func anyDiff(nodes []*DiffNode) bool {
+	for _, node := range nodes {
+		if node.hasDiff {
+			return true
+		}
+	}
+	return false
+}
+
+func funcKey(stack *StackExport) string {
+	if stack.FuncInfo == nil {
+		return ""
+	}
+	return stack.FuncInfo.Pkg + "." + stack.FuncInfo.IdentityName
+}
+
+func (c *DiffNode) stack() *StackExport {
+	if c.New != nil {
+		return c.New
+	}
+	return c.Old
+}
+
+func (c *DiffNode) name() string {
+	stack := c.stack()
+	if stack.FuncInfo == nil || stack.FuncInfo.IdentityName == "" {
+		return "<unknown>"
+	}
+	if stack.FuncInfo.Pkg == "" {
+		return stack.FuncInfo.IdentityName
+	}
+	return lastPart(stack.FuncInfo.Pkg) + "." + stack.FuncInfo.IdentityName
+}
+
+// formatJSON re-encodes v with sorted keys and indent,
+// so equal values always have the same representation
+func formatJSON(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	data, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+// writeDiffText prints only the calls that differ,
+// together with their ancestors as context
+func writeDiffText(w io.Writer, root *DiffNode) *DiffStat {
+	stat := &DiffStat{}
+	var walk func(node *DiffNode, depth int)
+	walk = func(node *DiffNode, depth int) {
+		if !node.hasDiff {
+			return
+		}
+		indent := strings.Repeat("    ", depth)
+		var mark string
+		switch node.Kind {
+		case DiffAdded:
+			mark = "+"
+			stat.Added++
+		case DiffRemoved:
+			mark = "-"
+			stat.Removed++
+		case DiffChanged:
+			mark = "~"
+			stat.Changed++
+		default:
+			mark = " "
+		}
+		fmt.Fprintf(w, "%s %s%s\n", mark, indent, node.name())
+		for _, change := range node.Changes {
+			fmt.Fprintf(w, "  %s    %s changed:\n", indent, change.Field)
+			for _, line := range diffLines(change.Old, change.New) {
+				fmt.Fprintf(w, "  %s      %s\n", indent, line)
+			}
+		}
+		for _, child := range node.Children {
+			walk(child, depth+1)
+		}
+	}
+	for _, child := range root.Children {
+		walk(child, 0)
+	}
+	if stat.Added+stat.Removed+stat.Changed == 0 {
+		fmt.Fprintf(w, "no differences\n")
+	} else {
+		fmt.Fprintf(w, "%d added, %d removed, %d changed\n", stat.Added, stat.Removed, stat.Changed)
+	}
+	return stat
+}
+
+// diffLines returns lines prefixed with "- " for lines
+// only in a, "+ " only in b and "  " for common lines
+func diffLines(a string, b string) []string {
+	var aLines, bLines []string
+	if a != "" {
+		aLines = strings.Split(a, "\n")
+	}
+	if b != "" {
+		bLines = strings.Split(b, "\n")
+	}
+	n, m := len(aLines), len(bLines)
+	if n*m > maxLCSCells {
+		return diffLinesGreedy(aLines, bLines)
+	}
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if aLines[i] == bLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var lines []string
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && aLines[i] == bLines[j]:
+			lines = append(lines, "  "+aLines[i])
+			i++
+			j++
+		case j >= m || (i < n && lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, "- "+aLines[i])
+			i++
+		default:
+			lines = append(lines, "+ "+bLines[j])
+			j++
+		}
+	}
+	return lines
+}
+
+// diffLinesGreedy aligns lines like diffStacksGreedy,
+// used for large values
+func diffLinesGreedy(aLines []string, bLines []string) []string {
+	// positions of each line in bLines, in order
+	positions := make(map[string][]int)
+	for j, line := range bLines {
+		positions[line] = append(positions[line], j)
+	}
+	var lines []string
+	j := 0
+	for _, line := range aLines {
+		pos := positions[line]
+		for len(pos) > 0 && pos[0] < j {
+			pos = pos[1:]
+		}
+		positions[line] = pos
+		if len(pos) == 0 {
+			lines = append(lines, "- "+line)
+			continue
+		}
+		for ; j < pos[0]; j++ {
+			lines = append(lines, "+ "+bLines[j])
+		}
+		lines = append(lines, "  "+line)
+		j++
+	}
+	for ; j < len(bLines); j++ {
+		lines = append(lines, "+ "+bLines[j])
+	}
+	return lines
+}
+
+func renderDiffHTML(root *DiffNode, oldFile string, newFile string, w io.Writer) {
+	var buf bytes.Buffer
+	stat := writeDiffText(io.Discard, root)
+
+	buf.WriteString(`<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="UTF-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1.0">
+	<title>Trace diff</title>
+	<style>`)
+	buf.WriteString(styles)
+	buf.WriteString(`</style>
+</head>
+<body>
+`)
+	fmt.Fprintf(&buf, `<div class="diff-summary">%s &rarr; %s: %d added, %d removed, %d changed</div>`+"\n",
+		html.EscapeString(oldFile), html.EscapeString(newFile), stat.Added, stat.Removed, stat.Changed)
+	buf.WriteString(`<ul class="trace-list diff-list">` + "\n")
+	for _, child := range root.Children {
+		renderDiffNode(&buf, child)
+	}
+	buf.WriteString("</ul>\n</body>\n</html>\n")
+	_, err := w.Write(buf.Bytes())
+	if err != nil {
+		panic(err)
+	}
+}
+
+func renderDiffNode(buf *bytes.Buffer, node *DiffNode) {
+	stack := node.stack()
+	cost := formatCost(stack.Begin, stack.End)
+	// unchanged subtrees are collapsed
+	open := ""
+	if node.hasDiff {
+		open = " open"
+	}
+	fmt.Fprintf(buf, `<li><details%s><summary class="diff-%s"><span class="head-name">%s</span> <span class="head-cost">%s</span></summary>`+"\n",
+		open, node.Kind, html.EscapeString(node.name()), cost)
+	for _, change := range node.Changes {
+		fmt.Fprintf(buf, `<div class="diff-change"><label>%s</label><pre>`, change.Field)
+		for _, line := range diffLines(change.Old, change.New) {
+			class := "diff-line"
+			if strings.HasPrefix(line, "- ") {
+				class += " diff-removed"
+			} else if strings.HasPrefix(line, "+ ") {
+				class += " diff-added"
+			}
+			fmt.Fprintf(buf, `<span class="%s">%s</span>`+"\n", class, html.EscapeString(line))
+		}
+		buf.WriteString("</pre></div>\n")
+	}
+	if len(node.Children) > 0 {
+		buf.WriteString(`<ul class="trace-sub-list">` + "\n")
+		for _, child := range node.Children {
+			renderDiffNode(buf, child)
+		}
+		buf.WriteString("</ul>\n")
+	}
+	buf.WriteString("</details></li>\n")
+}
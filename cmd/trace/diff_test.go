@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func parseRootJSON(t *testing.T, s string) *RootExport {
+	var root *RootExport
+	err := json.Unmarshal([]byte(s), &root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+// go test -run TestDiff -v ./cmd/trace
+func TestDiff(t *testing.T) {
+	oldRoot := parseRootJSON(t, `{"Children":[{"FuncInfo":{"Pkg":"main","IdentityName":"main"},"Begin":0,"End":100,"Children":[
+		{"FuncInfo":{"Pkg":"main","IdentityName":"A"},"Begin":0,"End":10,"Args":{"a":1}},
+		{"FuncInfo":{"Pkg":"main","IdentityName":"B"},"Begin":10,"End":20},
+		{"FuncInfo":{"Pkg":"main","IdentityName":"C"},"Begin":20,"End":30}
+	]}]}`)
+	newRoot := parseRootJSON(t, `{"Children":[{"FuncInfo":{"Pkg":"main","IdentityName":"main"},"Begin":0,"End":100,"Children":[
+		{"FuncInfo":{"Pkg":"main","IdentityName":"A"},"Begin":0,"End":10,"Args":{"a":2}},
+		{"FuncInfo":{"Pkg":"main","IdentityName":"C"},"Begin":20,"End":80,"Error":"C failed"},
+		{"FuncInfo":{"Pkg":"main","IdentityName":"D"},"Begin":80,"End":90}
+	]}]}`)
+	diff := diffRoots(oldRoot, newRoot, &DiffOptions{CostRatio: defaultCostRatio})
+
+	if len(diff.Children) != 1 {
+		t.Fatalf("expect 1 child, actual: %d", len(diff.Children))
+	}
+	mainNode := diff.Children[0]
+	if mainNode.Kind != DiffSame || !mainNode.hasDiff {
+		t.Fatalf("expect main same with diff in children, actual: %s %v", mainNode.Kind, mainNode.hasDiff)
+	}
+	var kinds []string
+	for _, child := range mainNode.Children {
+		kinds = append(kinds, child.name()+":"+string(child.Kind))
+	}
+	expectKinds := "main.A:changed,main.B:removed,main.C:changed,main.D:added"
+	if strings.Join(kinds, ",") != expectKinds {
+		t.Fatalf("expect kinds: %s, actual: %s", expectKinds, strings.Join(kinds, ","))
+	}
+	var fields []string
+	for _, change := range mainNode.Children[2].Changes {
+		fields = append(fields, change.Field)
+	}
+	if strings.Join(fields, ",") != "Error,Cost" {
+		t.Fatalf("expect C changes Error,Cost, actual: %v", fields)
+	}
+
+	var buf bytes.Buffer
+	stat := writeDiffText(&buf, diff)
+	if stat.Added != 1 || stat.Removed != 1 || stat.Changed != 2 {
+		t.Fatalf("bad stat: %+v", stat)
+	}
+	output := buf.String()
+	expectLines := []string{
+		"  main.main\n",
+		"~     main.A\n",
+		"Args changed:",
+		`-     "a": 1`,
+		`+     "a": 2`,
+		"-     main.B\n",
+		"~     main.C\n",
+		"Error changed:",
+		"+ C failed",
+		"Cost changed:",
+		"(6.0x)",
+		"+     main.D\n",
+		"1 added, 1 removed, 2 changed\n",
+	}
+	for _, line := range expectLines {
+		idx := strings.Index(output, line)
+		if idx < 0 {
+			t.Fatalf("expect output contains %q, actual:\n%s", line, output)
+		}
+		output = output[idx+len(line):]
+	}
+}
+
+// go test -run TestDiffSame -v ./cmd/trace
+func TestDiffSame(t *testing.T) {
+	root := parseRootJSON(t, `{"Children":[{"FuncInfo":{"Pkg":"main","IdentityName":"main"},"Args":{"b":1,"a":2}}]}`)
+	diff := diffRoots(root, root, &DiffOptions{CostRatio: defaultCostRatio})
+	var buf bytes.Buffer
+	stat := writeDiffText(&buf, diff)
+	if stat.Added+stat.Removed+stat.Changed != 0 {
+		t.Fatalf("expect no differences, actual: %s", buf.String())
+	}
+	if buf.String() != "no differences\n" {
+		t.Fatalf("expect no differences, actual: %q", buf.String())
+	}
+}
+
+// go test -run TestDiffGreedy -v ./cmd/trace
+func TestDiffGreedy(t *testing.T) {
+	newStacks := func(names ...string) []*StackExport {
+		stacks := make([]*StackExport, 0, len(names))
+		for _, name := range names {
+			stacks = append(stacks, &StackExport{FuncInfo: &FuncInfoExport{Pkg: "main", IdentityName: name}})
+		}
+		return stacks
+	}
+	kindsOf := func(nodes []*DiffNode) string {
+		var kinds []string
+		for _, node := range nodes {
+			kinds = append(kinds, node.name()+":"+string(node.Kind))
+		}
+		return strings.Join(kinds, ",")
+	}
+	saved := maxLCSCells
+	maxLCSCells = 0
+	nodes := diffStacks(newStacks("A", "B", "C"), newStacks("A", "C", "D"), nil)
+	maxLCSCells = saved
+	expectKinds := "main.A:same,main.B:removed,main.C:same,main.D:added"
+	if kindsOf(nodes) != expectKinds {
+		t.Fatalf("expect kinds: %s, actual: %s", expectKinds, kindsOf(nodes))
+	}
+
+	// calls in a big loop exceed the default limit
+	n := 3000
+	oldNames := make([]string, n)
+	newNames := make([]string, n-1)
+	for i := range oldNames {
+		oldNames[i] = "F"
+	}
+	for i := range newNames {
+		newNames[i] = "F"
+	}
+	nodes = diffStacks(newStacks(oldNames...), newStacks(newNames...), nil)
+	if len(nodes) != n || nodes[n-2].Kind != DiffSame || nodes[n-1].Kind != DiffRemoved {
+		t.Fatalf("expect %d nodes with the last removed, actual: %d", n, len(nodes))
+	}
+}
+
+// go test -run TestDiffLinesGreedy -v ./cmd/trace
+func TestDiffLinesGreedy(t *testing.T) {
+	saved := maxLCSCells
+	maxLCSCells = 0
+	lines := diffLines("{\n\"a\": 1,\n\"b\": 2\n}", "{\n\"b\": 2,\n\"c\": 3\n}")
+	maxLCSCells = saved
+	expect := strings.Join([]string{
+		"  {",
+		`- "a": 1,`,
+		`- "b": 2`,
+		`+ "b": 2,`,
+		`+ "c": 3`,
+		"  }",
+	}, "\n")
+	if strings.Join(lines, "\n") != expect {
+		t.Fatalf("expect:\n%s\nactual:\n%s", expect, strings.Join(lines, "\n"))
+	}
+
+	// a large value exceeds the default limit
+	n := 3000
+	var a, b []string
+	for i := 0; i < n; i++ {
+		a = append(a, fmt.Sprintf("%d,", i))
+		if i != n/2 {
+			b = append(b, fmt.Sprintf("%d,", i))
+		}
+	}
+	lines = diffLines(strings.Join(a, "\n"), strings.Join(b, "\n"))
+	if len(lines) != n || lines[n/2] != fmt.Sprintf("- %d,", n/2) {
+		t.Fatalf("expect %d lines with line %d removed, actual: %d", n, n/2, len(lines))
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed index.js
+var indexScript string
+
+// TraceEntry describes one trace file in the index page
+type TraceEntry struct {
+	File      string // relative to the directory, slash separated
+	Test      string `json:",omitempty"`
+	Goroutine string `json:",omitempty"`
+	Duration  int64  // ns
+	Calls     int
+	Errors    int
+	Panics    int
+	ModTime   time.Time
+	// set when the file cannot be parsed,
+	// e.g. a stream still being written
+	ParseError string `json:",omitempty"`
+}
+
+func serveDir(dir string, opts *serveOptions) {
+	server := http.NewServeMux()
+	server.HandleFunc("/", htmlHandler(func(w io.Writer) error {
+		entries, err := listTraces(dir)
+		if err != nil {
+			return err
+		}
+		renderIndexHTML(dir, entries, w)
+		return nil
+	}))
+	server.HandleFunc("/view", func(w http.ResponseWriter, r *http.Request) {
+		rel := r.URL.Query().Get("file")
+		htmlHandler(func(w io.Writer) error {
+			file, err := resolveTraceFile(dir, rel)
+			if err != nil {
+				return err
+			}
+			record, err := parseRecord(file)
+			if err != nil {
+				return err
+			}
+			renderRecordHTML(record, rel, w)
+			return nil
+		})(w, r)
+	})
+	// polled by the index page for live reload
+	server.HandleFunc("/api/list", func(w http.ResponseWriter, r *http.Request) {
+		entries, err := listTraces(dir)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+	})
+	listenAndOpen(server, opts)
+}
+
+// resolveTraceFile prevents escaping dir
+func resolveTraceFile(dir string, rel string) (string, error) {
+	if rel == "" {
+		return "", fmt.Errorf("requires file")
+	}
+	clean := filepath.Clean(filepath.FromSlash(rel))
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid file: %s", rel)
+	}
+	if !isTraceFile(clean) {
+		return "", fmt.Errorf("not a trace file: %s", rel)
+	}
+	return filepath.Join(dir, clean), nil
+}
+
+func isTraceFile(file string) bool {
+	return strings.HasSuffix(file, ".json") || isStreamFile(file)
+}
+
+type cachedEntry struct {
+	size    int64
+	modTime time.Time
+	entry   *TraceEntry
+}
+
+// parsing is skipped for files not changed since last listing
+var entryCache sync.Map // file -> *cachedEntry
+
+func listTraces(dir string) ([]*TraceEntry, error) {
+	var entries []*TraceEntry
+	err := filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if !isTraceFile(file) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		if v, ok := entryCache.Load(file); ok {
+			cached := v.(*cachedEntry)
+			if cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+				entries = append(entries, cached.entry)
+				return nil
+			}
+		}
+		entry := getTraceEntry(file, filepath.ToSlash(rel), info.ModTime())
+		entryCache.Store(file, &cachedEntry{
+			size:    info.Size(),
+			modTime: info.ModTime(),
+			entry:   entry,
+		})
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// newest first
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].ModTime.After(entries[j].ModTime)
+	})
+	return entries, nil
+}
+
+// getTraceEntry derives test and goroutine from the layout written
+// by the runtime: per-test traces are <TestName>.json, others are
+// <dir>/g_<goroutine>/t_<n>.json
+func getTraceEntry(file string, rel string, modTime time.Time) *TraceEntry {
+	entry := &TraceEntry{
+		File:    rel,
+		ModTime: modTime,
+	}
+	name := strings.TrimSuffix(strings.TrimSuffix(rel, ".jsonl"), ".json")
+	base := path.Base(name)
+	parent := path.Base(path.Dir(name))
+	if strings.HasPrefix(base, "t_") && strings.HasPrefix(parent, "g_") {
+		entry.Goroutine = parent
+	} else if !isStreamFile(rel) {
+		entry.Test = name
+	}
+
+	root, err := parseRecord(file)
+	if err != nil {
+		entry.ParseError = err.Error()
+		return entry
+	}
+	var minBegin, maxEnd int64
+	for i, stack := range root.Children {
+		if i == 0 || stack.Begin < minBegin {
+			minBegin = stack.Begin
+		}
+		if stack.End > maxEnd {
+			maxEnd = stack.End
+		}
+	}
+	entry.Duration = maxEnd - minBegin
+	var walk func(stack *StackExport)
+	walk = func(stack *StackExport) {
+		entry.Calls++
+		if stack.Error != "" {
+			entry.Errors++
+		}
+		if stack.Panic {
+			entry.Panics++
+		}
+		for _, child := range stack.Children {
+			walk(child)
+		}
+	}
+	for _, stack := range root.Children {
+		walk(stack)
+	}
+	return entry
+}
+
+func renderIndexHTML(dir string, entries []*TraceEntry, w io.Writer) {
+	h := func(s string) {
+		_, err := io.WriteString(w, s)
+		if err != nil {
+			panic(err)
+		}
+		_, err = io.WriteString(w, "\n")
+		if err != nil {
+			panic(err)
+		}
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		panic(err)
+	}
+	h(`<!DOCTYPE html>
+	<html lang="en">
+	<head>
+		<meta charset="UTF-8">
+		<meta name="viewport" content="width=device-width, initial-scale=1.0">
+		<title>Traces in ` + html.EscapeString(dir) + `</title>
+	</head>
+	<body>
+	`)
+	h(`<style>`)
+	h(styles)
+	h(`</style>`)
+	h(fmt.Sprintf(`<div class="index-header">Traces in %s <span id="index-status"></span></div>`, html.EscapeString(dir)))
+	h(`<table class="index-table">
+	<thead><tr>
+		<th data-key="File">Trace</th>
+		<th data-key="Test">Test</th>
+		<th data-key="Goroutine">Goroutine</th>
+		<th data-key="Duration">Duration</th>
+		<th data-key="Calls">Calls</th>
+		<th data-key="Errors">Status</th>
+		<th data-key="ModTime">Modified</th>
+	</tr></thead>
+	<tbody id="index-body"></tbody>
+	</table>`)
+	h("<script>")
+	h("window.onload = function(){")
+	// escape </script> in file names
+	h(" let entries = " + strings.ReplaceAll(string(data), "</", `<\/`))
+	h(indexScript)
+	h("}")
+	h("</script>")
+	h(`</body>
+	</html>`)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// go test -run TestListTraces -v ./cmd/trace
+func TestListTraces(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"TestA.json": `{"Children":[{"FuncInfo":{"IdentityName":"TestA"},"Begin":100,"End":2100,"Children":[
+			{"FuncInfo":{"IdentityName":"A"},"Begin":200,"End":300,"Error":"A failed"}
+		]}]}`,
+		"trace_20240301_100000/g_c000/t_1.json": `{"Children":[{"FuncInfo":{"IdentityName":"main"},"Begin":0,"End":500,"Panic":true}]}`,
+		"broken.json":                           `{`,
+		"notes.txt":                             `not a trace`,
+	}
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(file), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(file, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := listTraces(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byFile := make(map[string]*TraceEntry)
+	for _, entry := range entries {
+		byFile[entry.File] = entry
+	}
+	if len(byFile) != 3 {
+		t.Fatalf("expect 3 traces, actual: %d", len(byFile))
+	}
+	a := byFile["TestA.json"]
+	if a == nil || a.Test != "TestA" || a.Duration != 2000 || a.Calls != 2 || a.Errors != 1 || a.Panics != 0 {
+		t.Fatalf("bad TestA entry: %+v", a)
+	}
+	g := byFile["trace_20240301_100000/g_c000/t_1.json"]
+	if g == nil || g.Test != "" || g.Goroutine != "g_c000" || g.Duration != 500 || g.Panics != 1 {
+		t.Fatalf("bad goroutine entry: %+v", g)
+	}
+	broken := byFile["broken.json"]
+	if broken == nil || broken.ParseError == "" {
+		t.Fatalf("expect parse error for broken.json: %+v", broken)
+	}
+}
+
+// go test -run TestResolveTraceFile -v ./cmd/trace
+func TestResolveTraceFile(t *testing.T) {
+	_, err := resolveTraceFile("traces", "../secret.json")
+	if err == nil {
+		t.Fatalf("expect error for file outside dir")
+	}
+	_, err = resolveTraceFile("traces", "a/../../secret.json")
+	if err == nil {
+		t.Fatalf("expect error for file outside dir")
+	}
+	_, err = resolveTraceFile("traces", "a.txt")
+	if err == nil {
+		t.Fatalf("expect error for non trace file")
+	}
+	file, err := resolveTraceFile("traces", "g_1/t_1.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file != filepath.Join("traces", "g_1", "t_1.json") {
+		t.Fatalf("bad file: %s", file)
+	}
+}
+
+// go test -run TestRenderRecordEscapesFile -v ./cmd/trace
+func TestRenderRecordEscapesFile(t *testing.T) {
+	var buf bytes.Buffer
+	// the file query parameter of /view
+	renderRecordHTML(&RootExport{}, "</title><script>alert(1)</script>.json", &buf)
+	out := buf.String()
+	if strings.Contains(out, "<script>alert(1)") {
+		t.Fatalf("expect file name escaped, actual: %s", out)
+	}
+	if !strings.Contains(out, "<title>Trace of &lt;/title&gt;&lt;script&gt;alert(1)&lt;/script&gt;.json</title>") {
+		t.Fatalf("expect escaped title, actual: %s", out)
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+const exportHelp = `
+Usage:
+    xgo tool trace export [--format=folded|pprof] [-o FILE] <file>
+
+Convert a trace into a profile of wall time, so that
+existing tools can be used:
+    folded    folded stacks, one line per stack with its self time
+              in ns, input of flamegraph.pl, speedscope and inferno
+    pprof     gzipped profile.proto, input of 'go tool pprof'
+
+Options:
+    --format=F    output format, default folded
+    -o FILE       output file, default stdout
+`
+
+func handleExport(args []string) {
+	format := "folded"
+	var output string
+	var files []string
+	n := len(args)
+	for i := 0; i < n; i++ {
+		arg := args[i]
+		if arg == "-h" || arg == "--help" {
+			fmt.Print(strings.TrimPrefix(exportHelp, "\n"))
+			return
+		}
+		if arg == "--format" || arg == "-o" {
+			if i+1 >= n {
+				exitf("%s requires value", arg)
+			}
+			if arg == "-o" {
+				output = args[i+1]
+			} else {
+				format = args[i+1]
+			}
+			i++
+			continue
+		}
+		if strings.HasPrefix(arg, "--format=") {
+			format = strings.TrimPrefix(arg, "--format=")
+			continue
+		}
+		if strings.HasPrefix(arg, "-") {
+			exitf("unrecognized flag: %s", arg)
+		}
+		files = append(files, arg)
+	}
+	if len(files) != 1 {
+		exitf("export requires 1 file, see 'xgo tool trace export --help'")
+	}
+	if format != "folded" && format != "pprof" {
+		exitf("unknown format: %s, expect folded or pprof", format)
+	}
+	root, err := parseRecord(files[0])
+	if err != nil {
+		exitf("%s: %v", files[0], err)
+	}
+
+	var w io.Writer = os.Stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			exitf("%v", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	bw := bufio.NewWriter(w)
+	if format == "folded" {
+		err = writeFolded(bw, root)
+	} else {
+		err = writePprof(bw, root)
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		exitf("%v", err)
+	}
+}
+
+func exportFuncName(node *FlameNode) string {
+	if node.IdentityName == "" {
+		return "<unknown>"
+	}
+	if node.Pkg == "" {
+		return node.IdentityName
+	}
+	return node.Pkg + "." + node.IdentityName
+}
+
+// writeFolded writes stacks in Brendan Gregg's folded format:
+//
+//	main;pkg.A;pkg.B 1200
+//
+// The value is self time in ns, stacks without self time are omitted.
+func writeFolded(w io.Writer, root *RootExport) error {
+	var lines []string
+	var walk func(node *FlameNode, prefix string)
+	walk = func(node *FlameNode, prefix string) {
+		// space separates the value, semicolon separates frames
+		frame := strings.NewReplacer(" ", "_", ";", "_").Replace(exportFuncName(node))
+		path := frame
+		if prefix != "" {
+			path = prefix + ";" + frame
+		}
+		if node.Self > 0 {
+			lines = append(lines, fmt.Sprintf("%s %d", path, node.Self))
+		}
+		for _, child := range node.Children {
+			walk(child, path)
+		}
+	}
+	for _, node := range buildFlame(root.Children).Children {
+		walk(node, "")
+	}
+	sort.Strings(lines)
+	for _, line := range lines {
+		_, err := io.WriteString(w, line+"\n")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writePprof writes a gzipped profile.proto with one sample
+// per distinct stack, valued by number of calls and self time.
+// See https://github.com/google/pprof/blob/main/proto/profile.proto
+func writePprof(w io.Writer, root *RootExport) error {
+	p := &profileBuilder{
+		strings:   map[string]int64{"": 0},
+		stringTab: []string{""},
+		functions: make(map[string]uint64),
+	}
+	p.valueType(1, "calls", "count")
+	p.valueType(1, "wall", "nanoseconds")
+
+	var walk func(node *FlameNode, stack []uint64)
+	walk = func(node *FlameNode, stack []uint64) {
+		// leaf first
+		stack = append([]uint64{p.location(node)}, stack...)
+		p.sample(stack, int64(node.Calls), node.Self)
+		for _, child := range node.Children {
+			walk(child, stack)
+		}
+	}
+	flame := buildFlame(root.Children)
+	for _, node := range flame.Children {
+		walk(node, nil)
+	}
+
+	for _, s := range p.stringTab {
+		p.buf.bytes(6, []byte(s))
+	}
+	if !root.Begin.IsZero() {
+		p.buf.int(9, root.Begin.UnixNano())
+	}
+	p.buf.int(10, flame.Total)
+	var period protoBuffer
+	period.int(1, p.str("wall"))
+	period.int(2, p.str("nanoseconds"))
+	// the string table is already written, both strings exist
+	p.buf.bytes(11, period.data)
+	p.buf.int(12, 1)
+
+	gz := gzip.NewWriter(w)
+	_, err := gz.Write(p.buf.data)
+	if err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+type profileBuilder struct {
+	buf protoBuffer
+
+	strings   map[string]int64
+	stringTab []string
+
+	// function name -> id, location shares id with function
+	functions map[string]uint64
+}
+
+func (c *profileBuilder) str(s string) int64 {
+	if idx, ok := c.strings[s]; ok {
+		return idx
+	}
+	idx := int64(len(c.stringTab))
+	c.strings[s] = idx
+	c.stringTab = append(c.stringTab, s)
+	return idx
+}
+
+func (c *profileBuilder) valueType(field int, typ string, unit string) {
+	var msg protoBuffer
+	msg.int(1, c.str(typ))
+	msg.int(2, c.str(unit))
+	c.buf.bytes(field, msg.data)
+}
+
+func (c *profileBuilder) location(node *FlameNode) uint64 {
+	name := exportFuncName(node)
+	if id, ok := c.functions[name]; ok {
+		return id
+	}
+	id := uint64(len(c.functions) + 1)
+	c.functions[name] = id
+
+	var fn protoBuffer
+	fn.uint(1, id)
+	fn.int(2, c.str(name))
+	fn.int(3, c.str(name))
+	fn.int(4, c.str(node.File))
+	fn.int(5, int64(node.Line))
+	c.buf.bytes(5, fn.data)
+
+	var line protoBuffer
+	line.uint(1, id)
+	line.int(2, int64(node.Line))
+	var loc protoBuffer
+	loc.uint(1, id)
+	loc.bytes(4, line.data)
+	c.buf.bytes(4, loc.data)
+	return id
+}
+
+func (c *profileBuilder) sample(locations []uint64, calls int64, self int64) {
+	var ids protoBuffer
+	for _, id := range locations {
+		ids.varint(id)
+	}
+	var values protoBuffer
+	values.varint(uint64(calls))
+	values.varint(uint64(self))
+
+	var msg protoBuffer
+	msg.bytes(1, ids.data)
+	msg.bytes(2, values.data)
+	c.buf.bytes(2, msg.data)
+}
+
+// protoBuffer encodes the few protobuf wire
+// types needed by profile.proto
+type protoBuffer struct {
+	data []byte
+}
+
+func (c *protoBuffer) varint(v uint64) {
+	for v >= 0x80 {
+		c.data = append(c.data, byte(v)|0x80)
+		v >>= 7
+	}
+	c.data = append(c.data, byte(v))
+}
+
+func (c *protoBuffer) uint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	c.varint(uint64(field) << 3)
+	c.varint(v)
+}
+
+func (c *protoBuffer) int(field int, v int64) {
+	c.uint(field, uint64(v))
+}
+
+// bytes also encodes strings, embedded messages and packed fields
+func (c *protoBuffer) bytes(field int, b []byte) {
+	c.varint(uint64(field)<<3 | 2)
+	c.varint(uint64(len(b)))
+	c.data = append(c.data, b...)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestWriteFolded(t *testing.T) {
+	root := &RootExport{Children: []*StackExport{
+		call("main", 0, 100,
+			call("A", 0, 30, call("B", 5, 25)),
+			call("A", 40, 60),
+			call("B", 60, 90),
+		),
+	}}
+	var buf bytes.Buffer
+	err := writeFolded(&buf, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `example.com/demo.main 20
+example.com/demo.main;example.com/demo.A 30
+example.com/demo.main;example.com/demo.A;example.com/demo.B 20
+example.com/demo.main;example.com/demo.B 30
+`
+	if buf.String() != expect {
+		t.Fatalf("expect folded: %s, actual: %s", expect, buf.String())
+	}
+}
+
+func TestWritePprof(t *testing.T) {
+	main := call("main", 0, 100, call("A", 0, 30), call("A", 40, 50))
+	main.FuncInfo.File = "main.go"
+	main.FuncInfo.Line = 5
+	var buf bytes.Buffer
+	err := writePprof(&buf, &RootExport{Children: []*StackExport{main}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// decode the fields of profile.proto used by writePprof
+	var stringTab []string
+	var sampleTypes [][]byte
+	var samples [][]byte
+	var durationNanos uint64
+	funcNames := make(map[uint64]int64)      // function id -> name
+	locationFuncs := make(map[uint64]uint64) // location id -> function id
+	var mainFile int64 = -1
+	for _, field := range decodeProto(t, data) {
+		switch field.num {
+		case 1:
+			sampleTypes = append(sampleTypes, field.b)
+		case 2:
+			samples = append(samples, field.b)
+		case 4:
+			fields := decodeProto(t, field.b)
+			id := protoFieldValue(fields, 1)
+			line := decodeProto(t, protoFieldBytes(fields, 4))
+			locationFuncs[id] = protoFieldValue(line, 1)
+		case 5:
+			fields := decodeProto(t, field.b)
+			funcNames[protoFieldValue(fields, 1)] = int64(protoFieldValue(fields, 2))
+			if protoFieldValue(fields, 5) == 5 {
+				mainFile = int64(protoFieldValue(fields, 4))
+			}
+		case 6:
+			stringTab = append(stringTab, string(field.b))
+		case 10:
+			durationNanos = field.v
+		}
+	}
+	var types []string
+	for _, sampleType := range sampleTypes {
+		fields := decodeProto(t, sampleType)
+		types = append(types, stringTab[protoFieldValue(fields, 1)]+"/"+stringTab[protoFieldValue(fields, 2)])
+	}
+	if strings.Join(types, ",") != "calls/count,wall/nanoseconds" {
+		t.Fatalf("expect sample types calls/count,wall/nanoseconds, actual: %v", types)
+	}
+	if mainFile < 0 || stringTab[mainFile] != "main.go" {
+		t.Fatalf("expect main at main.go:5")
+	}
+	if durationNanos != 100 {
+		t.Fatalf("expect duration 100, actual: %d", durationNanos)
+	}
+
+	// stack(leaf first) -> calls,self
+	actual := make(map[string]string)
+	var selfSum uint64
+	for _, sample := range samples {
+		fields := decodeProto(t, sample)
+		var names []string
+		for _, loc := range decodeVarints(t, protoFieldBytes(fields, 1)) {
+			names = append(names, stringTab[funcNames[locationFuncs[loc]]])
+		}
+		values := decodeVarints(t, protoFieldBytes(fields, 2))
+		if len(values) != 2 {
+			t.Fatalf("expect 2 values per sample, actual: %v", values)
+		}
+		actual[strings.Join(names, ";")] = fmt.Sprintf("%d,%d", values[0], values[1])
+		selfSum += values[1]
+	}
+	expect := map[string]string{
+		"example.com/demo.main":                    "1,60",
+		"example.com/demo.A;example.com/demo.main": "2,40",
+	}
+	if len(actual) != len(expect) || len(samples) != len(expect) {
+		t.Fatalf("expect samples: %v, actual: %v", expect, actual)
+	}
+	for stack, values := range expect {
+		if actual[stack] != values {
+			t.Fatalf("expect sample %s: %s, actual: %s", stack, values, actual[stack])
+		}
+	}
+	// self values add up to total
+	if selfSum != durationNanos {
+		t.Fatalf("expect self sum %d, actual: %d", durationNanos, selfSum)
+	}
+}
+
+type protoField struct {
+	num int
+	v   uint64 // varint
+	b   []byte // length-delimited
+}
+
+func decodeProto(t *testing.T, data []byte) []protoField {
+	var fields []protoField
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			t.Fatalf("bad proto key")
+		}
+		data = data[n:]
+		field := protoField{num: int(key >> 3)}
+		switch key & 7 {
+		case 0:
+			field.v, n = binary.Uvarint(data)
+			if n <= 0 {
+				t.Fatalf("bad varint of field %d", field.num)
+			}
+			data = data[n:]
+		case 2:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < size {
+				t.Fatalf("bad length of field %d", field.num)
+			}
+			field.b = data[n : n+int(size)]
+			data = data[n+int(size):]
+		default:
+			t.Fatalf("unexpected wire type %d of field %d", key&7, field.num)
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+func decodeVarints(t *testing.T, data []byte) []uint64 {
+	var values []uint64
+	for len(data) > 0 {
+		v, n := binary.Uvarint(data)
+		if n <= 0 {
+			t.Fatalf("bad packed varint")
+		}
+		values = append(values, v)
+		data = data[n:]
+	}
+	return values
+}
+
+func protoFieldValue(fields []protoField, num int) uint64 {
+	for _, field := range fields {
+		if field.num == num {
+			return field.v
+		}
+	}
+	return 0
+}
+
+func protoFieldBytes(fields []protoField, num int) []byte {
+	for _, field := range fields {
+		if field.num == num {
+			return field.b
+		}
+	}
+	return nil
+}
+
+func TestProtoBufferVarint(t *testing.T) {
+	var buf protoBuffer
+	buf.varint(300)
+	if !bytes.Equal(buf.data, []byte{0xac, 0x02}) {
+		t.Fatalf("expect varint 300 to be ac 02, actual: %x", buf.data)
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"html"
+	"sort"
+)
+
+// FlameNode aggregates calls with the same function
+// under the same path from the root, durations are in ns.
+type FlameNode struct {
+	Pkg          string
+	IdentityName string
+	File         string
+	Line         int
+	Total        int64 // inclusive
+	Self         int64 // exclusive of children
+	Calls        int
+
+	Children []*FlameNode
+}
+
+// FuncStat aggregates all calls of a function regardless of path
+type FuncStat struct {
+	Pkg          string
+	IdentityName string
+	Self         int64
+	// recursive calls are counted only
+	// once, by the outermost call
+	Total int64
+	Calls int
+}
+
+// maxTopFuncs limits rows of the top functions table
+const maxTopFuncs = 100
+
+// flame nodes narrower than this ratio of the whole
+// graph are not rendered, they are unreadable anyway
+const minFlameRatio = 0.001
+
+func cost(stack *StackExport) int64 {
+	c := stack.End - stack.Begin
+	if c < 0 {
+		return 0
+	}
+	return c
+}
+
+// selfCost is cost excluding children, children
+// of the same goroutine never overlap
+func selfCost(stack *StackExport) int64 {
+	self := cost(stack)
+	for _, child := range stack.Children {
+		self -= cost(child)
+	}
+	if self < 0 {
+		return 0
+	}
+	return self
+}
+
+func buildFlame(stacks []*StackExport) *FlameNode {
+	root := &FlameNode{IdentityName: "<root>"}
+	for _, stack := range stacks {
+		addFlame(root, stack)
+		root.Total += cost(stack)
+	}
+	return root
+}
+
+func addFlame(parent *FlameNode, stack *StackExport) {
+	key := funcKey(stack)
+	var node *FlameNode
+	for _, child := range parent.Children {
+		if child.Pkg+"."+child.IdentityName == key {
+			node = child
+			break
+		}
+	}
+	if node == nil {
+		node = &FlameNode{}
+		if stack.FuncInfo != nil {
+			node.Pkg = stack.FuncInfo.Pkg
+			node.IdentityName = stack.FuncInfo.IdentityName
+			node.File = stack.FuncInfo.File
+			node.Line = stack.FuncInfo.Line
+		}
+		parent.Children = append(parent.Children, node)
+	}
+	node.Total += cost(stack)
+	node.Self += selfCost(stack)
+	node.Calls++
+	for _, child := range stack.Children {
+		addFlame(node, child)
+	}
+}
+
+// topFuncs returns functions sorted by self time, descending
+func topFuncs(stacks []*StackExport) []*FuncStat {
+	mapping := make(map[string]*FuncStat)
+	var stats []*FuncStat
+	// number of active calls of each function on the path
+	active := make(map[string]int)
+	var walk func(stack *StackExport)
+	walk = func(stack *StackExport) {
+		key := funcKey(stack)
+		stat := mapping[key]
+		if stat == nil {
+			stat = &FuncStat{}
+			if stack.FuncInfo != nil {
+				stat.Pkg = stack.FuncInfo.Pkg
+				stat.IdentityName = stack.FuncInfo.IdentityName
+			}
+			mapping[key] = stat
+			stats = append(stats, stat)
+		}
+		stat.Calls++
+		stat.Self += selfCost(stack)
+		if active[key] == 0 {
+			stat.Total += cost(stack)
+		}
+		active[key]++
+		for _, child := range stack.Children {
+			walk(child)
+		}
+		active[key]--
+	}
+	for _, stack := range stacks {
+		walk(stack)
+	}
+	sort.SliceStable(stats, func(i, j int) bool {
+		return stats[i].Self > stats[j].Self
+	})
+	return stats
+}
+
+func formatDuration(ns int64) string {
+	if ns == 0 {
+		return "0ns"
+	}
+	return formatCost(0, ns)
+}
+
+func flameName(pkg string, identityName string) string {
+	if identityName == "" {
+		return "<unknown>"
+	}
+	if pkg == "" {
+		return identityName
+	}
+	return lastPart(pkg) + "." + identityName
+}
+
+// flameColor is stable per package so that
+// calls of a package are easy to spot
+func flameColor(pkg string) string {
+	h := fnv.New32a()
+	h.Write([]byte(pkg))
+	sum := h.Sum32()
+	// warm colors like classic flame graphs
+	return fmt.Sprintf("hsl(%d, 80%%, %d%%)", 10+sum%40, 60+(sum>>8)%15)
+}
+
+func renderFlame(h func(s string), root *FlameNode) {
+	if root.Total <= 0 {
+		h(`<div class="view-empty">no timing data</div>`)
+		return
+	}
+	h(`<div class="flame">`)
+	renderFlameNode(h, root, root.Total, 100)
+	h(`</div>`)
+}
+
+// width is the percentage relative to the parent
+func renderFlameNode(h func(s string), node *FlameNode, total int64, width float64) {
+	name := flameName(node.Pkg, node.IdentityName)
+	fullName := name
+	if node.Pkg != "" {
+		fullName = node.Pkg + "." + node.IdentityName
+	}
+	title := fmt.Sprintf("%s\ntotal: %s (%.1f%%)\nself: %s\ncalls: %d", fullName, formatDuration(node.Total), float64(node.Total)*100/float64(total), formatDuration(node.Self), node.Calls)
+	h(fmt.Sprintf(`<div class="flame-node" style="width:%.4f%%">`, width))
+	h(fmt.Sprintf(`<div class="flame-label" style="background-color:%s" title="%s">%s</div>`, flameColor(node.Pkg), html.EscapeString(title), html.EscapeString(name)))
+	if len(node.Children) > 0 && node.Total > 0 {
+		h(`<div class="flame-children">`)
+		for _, child := range node.Children {
+			if float64(child.Total) < float64(total)*minFlameRatio {
+				continue
+			}
+			renderFlameNode(h, child, total, float64(child.Total)*100/float64(node.Total))
+		}
+		h(`</div>`)
+	}
+	h(`</div>`)
+}
+
+// renderTimeline places each call at its Begin on a shared
+// time axis, one lane per depth. Clicking a call shows it in the tree.
+func renderTimeline(h func(s string), stacks []*StackExport, traceIDMapping map[*StackExport]int64) {
+	var minBegin, maxEnd int64
+	var depth int
+	var scan func(stack *StackExport, d int)
+	scan = func(stack *StackExport, d int) {
+		if d > depth {
+			depth = d
+		}
+		for _, child := range stack.Children {
+			scan(child, d+1)
+		}
+	}
+	for i, stack := range stacks {
+		if i == 0 || stack.Begin < minBegin {
+			minBegin = stack.Begin
+		}
+		if stack.End > maxEnd {
+			maxEnd = stack.End
+		}
+		scan(stack, 1)
+	}
+	span := maxEnd - minBegin
+	if span <= 0 {
+		h(`<div class="view-empty">no timing data</div>`)
+		return
+	}
+	h(fmt.Sprintf(`<div class="timeline-axis"><span>0</span><span>%s</span></div>`, formatDuration(span)))
+	h(fmt.Sprintf(`<div class="timeline" style="height:%dem">`, depth*timelineLaneEm))
+	var walk func(stack *StackExport, d int)
+	walk = func(stack *StackExport, d int) {
+		var pkg, identityName string
+		if stack.FuncInfo != nil {
+			pkg = stack.FuncInfo.Pkg
+			identityName = stack.FuncInfo.IdentityName
+		}
+		name := flameName(pkg, identityName)
+		class := "timeline-item"
+		if stack.Panic {
+			class += " panic"
+		} else if stack.Error != "" {
+			class += " error"
+		}
+		left := float64(stack.Begin-minBegin) * 100 / float64(span)
+		width := float64(cost(stack)) * 100 / float64(span)
+		title := fmt.Sprintf("%s\n%s", name, formatDuration(cost(stack)))
+		h(fmt.Sprintf(`<div class="%s" style="left:%.4f%%;width:%.4f%%;top:%dem;background-color:%s" title="%s" onclick="onClickTimeline('%d')">%s</div>`,
+			class, left, width, (d-1)*timelineLaneEm, flameColor(pkg), html.EscapeString(title), traceIDMapping[stack], html.EscapeString(name)))
+		for _, child := range stack.Children {
+			walk(child, d+1)
+		}
+	}
+	for _, stack := range stacks {
+		walk(stack, 1)
+	}
+	h(`</div>`)
+}
+
+const timelineLaneEm = 2
+
+func renderTopFuncs(h func(s string), stats []*FuncStat) {
+	if len(stats) == 0 {
+		h(`<div class="view-empty">no calls</div>`)
+		return
+	}
+	h(`<table class="index-table top-table">`)
+	h(`<thead><tr><th>Function</th><th>Package</th><th>Calls</th><th>Self</th><th>Total</th></tr></thead>`)
+	h(`<tbody>`)
+	for i, stat := range stats {
+		if i >= maxTopFuncs {
+			break
+		}
+		h(fmt.Sprintf(`<tr><td>%s</td><td>%s</td><td class="index-number">%d</td><td class="index-number">%s</td><td class="index-number">%s</td></tr>`,
+			html.EscapeString(flameName("", stat.IdentityName)),
+			html.EscapeString(stat.Pkg),
+			stat.Calls,
+			formatDuration(stat.Self),
+			formatDuration(stat.Total),
+		))
+	}
+	h(`</tbody>`)
+	h(`</table>`)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func call(name string, begin int64, end int64, children ...*StackExport) *StackExport {
+	return &StackExport{
+		FuncInfo: &FuncInfoExport{Pkg: "example.com/demo", IdentityName: name},
+		Begin:    begin,
+		End:      end,
+		Children: children,
+	}
+}
+
+func TestBuildFlame(t *testing.T) {
+	stacks := []*StackExport{
+		call("main", 0, 100,
+			call("A", 0, 30, call("B", 5, 25)),
+			call("A", 40, 60),
+			call("B", 60, 90),
+		),
+	}
+	root := buildFlame(stacks)
+	if root.Total != 100 || len(root.Children) != 1 {
+		t.Fatalf("bad root: %+v", root)
+	}
+	main := root.Children[0]
+	if main.Total != 100 || main.Self != 20 || len(main.Children) != 2 {
+		t.Fatalf("bad main: %+v", main)
+	}
+	a, b := main.Children[0], main.Children[1]
+	if a.IdentityName != "A" || a.Calls != 2 || a.Total != 50 || a.Self != 30 {
+		t.Fatalf("bad A: %+v", a)
+	}
+	if b.IdentityName != "B" || b.Calls != 1 || b.Total != 30 || b.Self != 30 {
+		t.Fatalf("bad B: %+v", b)
+	}
+	if len(a.Children) != 1 || a.Children[0].Total != 20 {
+		t.Fatalf("bad A.B: %+v", a.Children)
+	}
+}
+
+func TestTopFuncs(t *testing.T) {
+	stacks := []*StackExport{
+		call("main", 0, 100,
+			// recursive
+			call("Fib", 0, 60, call("Fib", 10, 40, call("Fib", 20, 30))),
+			call("Sleep", 60, 100),
+		),
+	}
+	stats := topFuncs(stacks)
+	if len(stats) != 3 {
+		t.Fatalf("expect 3 funcs, actual: %d", len(stats))
+	}
+	fib, sleep, main := stats[0], stats[1], stats[2]
+	if fib.IdentityName != "Fib" || fib.Calls != 3 || fib.Self != 60 || fib.Total != 60 {
+		t.Fatalf("bad Fib: %+v", fib)
+	}
+	if sleep.IdentityName != "Sleep" || sleep.Self != 40 || sleep.Total != 40 {
+		t.Fatalf("bad Sleep: %+v", sleep)
+	}
+	if main.IdentityName != "main" || main.Self != 0 || main.Total != 100 {
+		t.Fatalf("bad main: %+v", main)
+	}
+}
+
+func TestRenderViews(t *testing.T) {
+	stacks := []*StackExport{call("main", 0, 100, call("A", 10, 50))}
+	var buf bytes.Buffer
+	renderRecordHTML(&RootExport{Children: stacks}, "t.json", &buf)
+	out := buf.String()
+	for _, expect := range []string{`id="view-flame"`, `id="view-timeline"`, `id="view-top"`, `class="flame-label"`, `onClickTimeline(`} {
+		if !strings.Contains(out, expect) {
+			t.Fatalf("expect html to contain %q", expect)
+		}
+	}
+
+	// traces without timing
+	buf.Reset()
+	renderRecordHTML(&RootExport{Children: []*StackExport{call("main", 0, 0)}}, "t.json", &buf)
+	if !strings.Contains(buf.String(), "no timing data") {
+		t.Fatalf("expect no timing data")
+	}
+}
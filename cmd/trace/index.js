@@ -0,0 +1,138 @@
+// this script runs after window.onload
+// let entries = [...]
+
+// sort by modified time, newest first
+let sortKey = "ModTime"
+let sortDesc = true
+
+const pollInterval = 2000
+
+function formatDuration(ns) {
+    if (!ns) {
+        return ""
+    }
+    const units = [["ns", 1000], ["μs", 1000], ["ms", 1000], ["s", 60], ["m", Infinity]]
+    let f = ns
+    for (const [unit, next] of units) {
+        if (f < next) {
+            return `${Math.floor(f)}${unit}`
+        }
+        f = f / next
+    }
+}
+
+function formatTime(t) {
+    const d = new Date(t)
+    if (isNaN(d.getTime())) {
+        return ""
+    }
+    return d.toLocaleString()
+}
+
+function escapeHTML(s) {
+    const div = document.createElement("div")
+    div.innerText = s || ""
+    return div.innerHTML
+}
+
+function compareEntries(a, b) {
+    let x = a[sortKey]
+    let y = b[sortKey]
+    if (sortKey === "Errors") {
+        // panics are worse than errors
+        x = (a.Panics || 0) * 1e9 + (a.Errors || 0)
+        y = (b.Panics || 0) * 1e9 + (b.Errors || 0)
+    }
+    if (x === y) {
+        return 0
+    }
+    if (x === undefined || x === null) {
+        return 1
+    }
+    if (y === undefined || y === null) {
+        return -1
+    }
+    const less = x < y ? -1 : 1
+    return sortDesc ? -less : less
+}
+
+function renderStatus(entry) {
+    if (entry.ParseError) {
+        return `<span class="index-status-error" title="${escapeHTML(entry.ParseError)}">unreadable</span>`
+    }
+    const parts = []
+    if (entry.Panics) {
+        parts.push(`<span class="index-status-panic">${entry.Panics} panic</span>`)
+    }
+    if (entry.Errors) {
+        parts.push(`<span class="index-status-error">${entry.Errors} error</span>`)
+    }
+    if (parts.length === 0) {
+        return `<span class="index-status-ok">ok</span>`
+    }
+    return parts.join(" ")
+}
+
+function renderEntries() {
+    const sorted = entries.slice().sort(compareEntries)
+    const rows = []
+    for (const entry of sorted) {
+        const href = "/view?file=" + encodeURIComponent(entry.File)
+        rows.push(`<tr>
+            <td><a href="${href}">${escapeHTML(entry.File)}</a></td>
+            <td>${escapeHTML(entry.Test)}</td>
+            <td>${escapeHTML(entry.Goroutine)}</td>
+            <td class="index-number">${formatDuration(entry.Duration)}</td>
+            <td class="index-number">${entry.Calls || ""}</td>
+            <td>${renderStatus(entry)}</td>
+            <td>${formatTime(entry.ModTime)}</td>
+        </tr>`)
+    }
+    document.getElementById("index-body").innerHTML = rows.join("\n")
+
+    for (const th of document.querySelectorAll(".index-table th")) {
+        th.classList.remove("sort-asc", "sort-desc")
+        if (th.dataset.key === sortKey) {
+            th.classList.add(sortDesc ? "sort-desc" : "sort-asc")
+        }
+    }
+    document.getElementById("index-status").innerText = `${entries.length} traces`
+}
+
+function onClickSort(key) {
+    if (sortKey === key) {
+        sortDesc = !sortDesc
+    } else {
+        sortKey = key
+        // durations and errors are most interesting when large
+        sortDesc = key === "Duration" || key === "Errors" || key === "Calls" || key === "ModTime"
+    }
+    renderEntries()
+}
+
+// live reload: re-render when traces are added or changed
+let lastData = JSON.stringify(entries)
+async function poll() {
+    try {
+        const resp = await fetch("/api/list")
+        if (resp.ok) {
+            const list = (await resp.json()) || []
+            const data = JSON.stringify(list)
+            if (data !== lastData) {
+                lastData = data
+                entries = list
+                renderEntries()
+            }
+        }
+    } catch (e) {
+        // server stopped, keep the page as is
+    }
+    setTimeout(poll, pollInterval)
+}
+
+for (const th of document.querySelectorAll(".index-table th")) {
+    th.addEventListener("click", () => onClickSort(th.dataset.key))
+}
+entries = entries || []
+renderEntries()
+setTimeout(poll, pollInterval)
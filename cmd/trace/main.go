@@ -6,56 +6,91 @@ import (
 	"fmt"
 	"html"
 	"io"
-	"net/http"
 	"os"
-	"runtime/debug"
+	"sort"
 	"strings"
-	"time"
-
-	"github.com/xhd2015/xgo/support/cmd"
 )
 
+const help = `
+Usage:
+    xgo tool trace [flags] <file or dir>
+    xgo tool trace diff [flags] <old.json> <new.json>
+    xgo tool trace export [--format=folded|pprof] <file>
+
+View a trace in browser. A directory serves an index page
+of all traces under it.
+
+Flags:
+    --port PORT         port to listen, default 7070, 0 picks a free port
+    --bind ADDR         address to listen, default all interfaces
+    --no-open           do not open the browser
+    --export FILE       write a self-contained HTML file instead of serving
+    -h, --help          show help
+`
+
 func main() {
 	args := os.Args[1:]
 	if len(args) == 0 {
 		fmt.Fprintf(os.Stderr, "requires file\n")
 		os.Exit(1)
 	}
-	file := args[0]
-	serveFile(file)
+	if args[0] == "diff" {
+		handleDiff(args[1:])
+		return
+	}
+	if args[0] == "export" {
+		handleExport(args[1:])
+		return
+	}
+	opts := &serveOptions{port: defaultPort}
+	var files []string
+	n := len(args)
+	for i := 0; i < n; i++ {
+		arg := args[i]
+		if arg == "-h" || arg == "--help" {
+			fmt.Print(strings.TrimPrefix(help, "\n"))
+			return
+		}
+		consumed, err := parseServeFlag(args, i, opts)
+		if err != nil {
+			exitf("%v", err)
+		}
+		if consumed > 0 {
+			i += consumed - 1
+			continue
+		}
+		if strings.HasPrefix(arg, "-") {
+			exitf("unrecognized flag: %s", arg)
+		}
+		files = append(files, arg)
+	}
+	if len(files) != 1 {
+		exitf("requires exactly 1 file or dir, see 'xgo tool trace --help'")
+	}
+	file := files[0]
+	stat, err := os.Stat(file)
+	if err != nil {
+		exitf("%v", err)
+	}
+	if stat.IsDir() {
+		if opts.export != "" {
+			exitf("--export requires a file, found dir: %s", file)
+		}
+		serveDir(file, opts)
+		return
+	}
+	serveFile(file, opts)
 }
 
-func serveFile(file string) {
-	server := http.NewServeMux()
-	server.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		defer func() {
-			if e := recover(); e != nil {
-				stack := debug.Stack()
-				io.WriteString(w, fmt.Sprintf("<pre>panic: %v\n%s</pre>", e, stack))
-			}
-		}()
+func serveFile(file string, opts *serveOptions) {
+	serve(func(w io.Writer) error {
 		record, err := parseRecord(file)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			io.WriteString(w, fmt.Sprintf("%v", err))
-			return
+			return err
 		}
-		w.Header().Set("Content-Type", "text/html")
 		renderRecordHTML(record, file, w)
-	})
-	port := 7070
-	url := fmt.Sprintf("http://localhost:%d", port)
-	fmt.Printf("Server listen at %s\n", url)
-
-	go func() {
-		time.Sleep(500 * time.Millisecond)
-		cmd.Run("open", url)
-	}()
-
-	err := http.ListenAndServe(":7070", server)
-	if err != nil {
-		panic(err)
-	}
+		return nil
+	}, opts)
 }
 
 //go:embed style.css
@@ -65,6 +100,9 @@ var styles string
 var script string
 
 func parseRecord(file string) (*RootExport, error) {
+	if isStreamFile(file) {
+		return parseStreamFile(file)
+	}
 	data, err := os.ReadFile(file)
 	if err != nil {
 		return nil, err
@@ -93,16 +131,17 @@ func renderRecordHTML(root *RootExport, file string, w io.Writer) {
 	<head>
 		<meta charset="UTF-8">
 		<meta name="viewport" content="width=device-width, initial-scale=1.0">
-		<title>Trace of ` + file + `</title>
+		<title>Trace of ` + html.EscapeString(file) + `</title>
 	</head>
 	<body style="height: 100%;">
 	`,
 	)
 
-	h(`<div style="height: 100%;">`)
+	h(`<div class="page">`)
 	h(`<style>`)
 	h(styles)
 	h(`</style>`)
+	renderViewTabs(h)
 
 	top := &StackExport{
 		FuncInfo: &FuncInfoExport{
@@ -115,13 +154,22 @@ func renderRecordHTML(root *RootExport, file string, w io.Writer) {
 	h("window.onload = function(){")
 	h(" const traces = {}")
 	h(" const ids = []")
+	h(" const parents = {}")
+	editorURLJSON, _ := json.Marshal(getEditorURL())
+	h(" const editorURL = " + strings.ReplaceAll(string(editorURLJSON), "</", `<\/`))
 	traceIDMapping := make(map[*StackExport]int64)
+	pkgMapping := make(map[string]bool)
+	var pkgs []string
 	nextID := int64(1)
-	var walk func(stack *StackExport)
-	walk = func(stack *StackExport) {
+	var walk func(stack *StackExport, parentID int64)
+	walk = func(stack *StackExport, parentID int64) {
 		id := nextID
 		nextID++
 		traceIDMapping[stack] = id
+		if stack.FuncInfo != nil && stack.FuncInfo.Pkg != "" && !pkgMapping[stack.FuncInfo.Pkg] {
+			pkgMapping[stack.FuncInfo.Pkg] = true
+			pkgs = append(pkgs, stack.FuncInfo.Pkg)
+		}
 
 		stackData, err := marshalStackWithoutChildren(stack)
 		if err != nil {
@@ -129,21 +177,25 @@ func renderRecordHTML(root *RootExport, file string, w io.Writer) {
 		}
 		h(fmt.Sprintf(` traces["%d"] = %s`, id, stackData))
 		h(fmt.Sprintf(` ids.push("%d")`, id))
+		if parentID > 0 {
+			h(fmt.Sprintf(` parents["%d"] = "%d"`, id, parentID))
+		}
 		for _, child := range stack.Children {
-			walk(child)
+			walk(child, id)
 		}
 	}
-	walk(top)
+	walk(top, 0)
+	sort.Strings(pkgs)
 
 	h(script)
 	h("}")
 	h("</script>")
 
-	h(`<div class="root">`)
+	h(`<div id="view-tree" class="root view">`)
 
 	h(`<div class="trace-list-root">`)
 	h(`<div>`)
-	renderToolbar(h)
+	renderToolbar(h, pkgs)
 	h(`</div>`)
 	// h(fmt.Sprintf(`<ul id="%s" class="trace-list">`, getTraceListID(traceIDMapping[top])))
 	h(`<ul class="trace-list">`)
@@ -155,6 +207,9 @@ func renderRecordHTML(root *RootExport, file string, w io.Writer) {
 	h(`<div id="detail-info">
 	   <div class="label-value"> <label>Pkg:</label>	   <div id="detail-info-pkg"> </div> </div>
 	   <div class="label-value"> <label>Func:</label>    <div id="detail-info-func"> </div> </div>
+	   <div class="label-value"> <label>File:</label>    <a id="detail-info-file" title="open in editor"></a> </div>
+	   <div class="label-value"> <label>Called at:</label>    <a id="detail-info-call" title="open in editor"></a> </div>
+	   <div class="label-value"> <label>Context:</label>    <div id="detail-info-ctx"> </div> </div>
 	</div>`)
 	h(`<label>Request</label>`)
 	h(`<textarea id="detail-request"  placeholder="request..."></textarea>`)
@@ -164,12 +219,67 @@ func renderRecordHTML(root *RootExport, file string, w io.Writer) {
 
 	h("</div>")
 
+	h(`<div id="view-flame" class="view view-scroll hidden">`)
+	renderFlame(h, buildFlame(root.Children))
+	h("</div>")
+	h(`<div id="view-timeline" class="view view-scroll hidden">`)
+	renderTimeline(h, root.Children, traceIDMapping)
+	h("</div>")
+	h(`<div id="view-top" class="view view-scroll hidden">`)
+	renderTopFuncs(h, topFuncs(root.Children))
+	h("</div>")
+
 	h("</div>")
 	h(`</body>
 	</html>`)
 }
-func renderToolbar(h func(s string)) {
+
+var views = []string{"tree", "flame", "timeline", "top"}
+
+var viewTitles = map[string]string{
+	"tree":     "Tree",
+	"flame":    "Flame Graph",
+	"timeline": "Timeline",
+	"top":      "Top Functions",
+}
+
+func renderViewTabs(h func(s string)) {
+	h(`<div class="view-tabs">`)
+	for i, view := range views {
+		class := "view-tab"
+		if i == 0 {
+			class += " active"
+		}
+		h(fmt.Sprintf(`<div id="view-tab-%s" class="%s" onclick="onClickView('%s')">%s</div>`, view, class, view, viewTitles[view]))
+	}
+	h(`</div>`)
+}
+
+// default opens file in VSCode, set XGO_TRACE_EDITOR_URL
+// for other editors, e.g. idea://open?file={file}&line={line}
+const defaultEditorURL = "vscode://file/{file}:{line}"
+
+func getEditorURL() string {
+	if url := os.Getenv("XGO_TRACE_EDITOR_URL"); url != "" {
+		return url
+	}
+	return defaultEditorURL
+}
+
+func renderToolbar(h func(s string), pkgs []string) {
+	h(`<div class="toolbar-row">`)
 	h(fmt.Sprintf(`<div id="toolbar" class="toggle-all-on" onClick="onClickExpandAll(arguments[0])">%s</div>`, svgExpand))
+	h(`<input id="search" class="toolbar-input" placeholder="search func, args..." title="Enter: next match, Shift+Enter: previous match" oninput="onSearchInput()" onkeydown="onSearchKeyDown(arguments[0])">`)
+	h(`<span id="search-count"></span>`)
+	h(`<select id="filter-pkg" class="toolbar-input" onchange="onChangePkgFilter()">`)
+	h(`<option value="">all packages</option>`)
+	for _, pkg := range pkgs {
+		h(fmt.Sprintf(`<option value="%s">%s</option>`, html.EscapeString(pkg), html.EscapeString(pkg)))
+	}
+	h(`</select>`)
+	h(`<button onclick="onClickNextError()">next error</button>`)
+	h(`<label class="toolbar-label">slow &ge; <input id="slow-threshold" class="toolbar-input" type="number" min="0" step="any" oninput="onChangeSlowThreshold()"> ms</label>`)
+	h(`</div>`)
 }
 
 func getTraceListID(id int64) string {
@@ -238,11 +348,16 @@ func add(h func(string), stack *StackExport, traceIDMapping map[*StackExport]int
 		headClass = headClass + " error"
 	}
 
+	var title string
+	if stack.FuncInfo != nil && stack.FuncInfo.File != "" {
+		title = fmt.Sprintf("%s:%d", stack.FuncInfo.File, stack.FuncInfo.Line)
+	}
+
 	h(fmt.Sprintf(`<div class="head">
 	%s
 	<div class="head-info" id="head_%d" onclick="onClickHead('%d')">
 		<div class="%s"></div>
-		<span class="head-name">%s</span>
+		<span class="head-name" title="%s">%s</span>
 		<span class="head-cost">%s</span>
 	</div>
 	</div>
@@ -250,6 +365,7 @@ func add(h func(string), stack *StackExport, traceIDMapping map[*StackExport]int
 		indicator,
 		id, id,
 		headClass,
+		html.EscapeString(title),
 		html.EscapeString(name),
 		formatCost(stack.Begin, stack.End),
 	))
@@ -274,6 +390,7 @@ func lastPart(pkg string) string {
 	return pkg[idx+1:]
 }
 
+// begin and end are in nanoseconds
 func formatCost(begin int64, end int64) string {
 	if end == 0 && begin == 0 {
 		return ""
@@ -284,17 +401,21 @@ func formatCost(begin int64, end int64) string {
 		sign = "-"
 		cost = -cost
 	}
-	unit := "μs"
+	unit := "ns"
 	f := float64(cost)
 	if f >= 1000 {
 		f = f / 1000
-		unit = "ms"
+		unit = "μs"
 		if f >= 1000 {
 			f = f / 1000
-			unit = "s"
-			if f >= 60 {
-				f = f / 60
-				unit = "m"
+			unit = "ms"
+			if f >= 1000 {
+				f = f / 1000
+				unit = "s"
+				if f >= 60 {
+					f = f / 60
+					unit = "m"
+				}
 			}
 		}
 	}
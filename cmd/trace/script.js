@@ -42,6 +42,14 @@ function onClickHead(id) {
         const resp = document.getElementById("detail-response")
         const traceData = traces[id]
 
+        const infoFile = document.getElementById("detail-info-file")
+        setFileLink(infoFile, traceData.FuncInfo?.File, traceData.FuncInfo?.Line)
+        const infoCall = document.getElementById("detail-info-call")
+        setFileLink(infoCall, traceData.CallFile, traceData.CallLine)
+        const infoCtx = document.getElementById("detail-info-ctx")
+        if (infoCtx) {
+            infoCtx.innerText = formatCtx(traceData.Ctx)
+        }
         if (traceData.error) {
             infoPkg.innerText = "<unknown>"
             infoFunc.innerText = "<unknown>"
@@ -65,6 +73,39 @@ function onClickHead(id) {
     }
 }
 
+// one line summary of the ctx argument
+function formatCtx(ctx) {
+    if (!ctx) {
+        return ""
+    }
+    const parts = []
+    if (ctx.Deadline) {
+        parts.push(`deadline: ${ctx.Deadline}`)
+    }
+    if (ctx.Err) {
+        parts.push(`err: ${ctx.Err}`)
+    }
+    for (const name of Object.keys(ctx.Values || {}).sort()) {
+        parts.push(`${name}=${JSON.stringify(ctx.Values[name])}`)
+    }
+    return parts.join(", ")
+}
+
+// editor URL of the source, see editorURL
+function setFileLink(el, file, line) {
+    if (!el) {
+        return
+    }
+    if (!file) {
+        el.innerText = ""
+        el.removeAttribute("href")
+        return
+    }
+    line = line || 1
+    el.innerText = `${file}:${line}`
+    el.href = editorURL.replace("{file}", encodeURI(file)).replace("{line}", line)
+}
+
 function onClickToggle(e, id) {
     e.stopPropagation()
 
@@ -130,11 +171,214 @@ function toggleTraceList(id, toggle, collapsed) {
     traceList.classList.remove("collapsed")
 }
 
+function getAncestors(id) {
+    const list = []
+    let parent = parents[id]
+    while (parent) {
+        list.push(parent)
+        parent = parents[parent]
+    }
+    return list
+}
+
+function getSelectedTraceID() {
+    if (!selectedID) {
+        return ""
+    }
+    return selectedID.slice(getHeadID("").length)
+}
+
+// expand all ancestors of the trace, then select and scroll to it
+function revealTrace(id) {
+    for (const parent of getAncestors(id)) {
+        toggleTraceList(parent, false, false)
+        setToggle(parent, false, false)
+    }
+    const el = document.getElementById(getHeadID(id))
+    if (!el) {
+        return
+    }
+    if (selectedID !== getHeadID(id)) {
+        onClickHead(id)
+    }
+    el.scrollIntoView({ block: "center" })
+}
+
+function isFilteredOut(id) {
+    const el = document.getElementById(getHeadID(id))
+    return !el || !!el.closest(".filtered")
+}
+
+// search
+let searchMatches = []
+let searchIndex = -1
+const searchTexts = {}
+
+function getSearchText(id) {
+    let text = searchTexts[id]
+    if (text === undefined) {
+        const traceData = traces[id]
+        const parts = [
+            traceData.FuncInfo?.Pkg || "",
+            traceData.FuncInfo?.IdentityName || "",
+            JSON.stringify(traceData.Args) || "",
+            JSON.stringify(traceData.Results) || "",
+            traceData.Error || "",
+        ]
+        text = parts.join("\n").toLowerCase()
+        searchTexts[id] = text
+    }
+    return text
+}
+
+function onSearchInput() {
+    for (const id of searchMatches) {
+        document.getElementById(getHeadID(id))?.classList.remove("match")
+    }
+    searchMatches = []
+    searchIndex = -1
+    const count = document.getElementById("search-count")
+    const query = document.getElementById("search").value.trim().toLowerCase()
+    if (!query) {
+        count.innerText = ""
+        return
+    }
+    for (const id of ids) {
+        if (!parents[id] || isFilteredOut(id)) {
+            // the <root>
+            continue
+        }
+        if (getSearchText(id).includes(query)) {
+            searchMatches.push(id)
+            document.getElementById(getHeadID(id))?.classList.add("match")
+        }
+    }
+    if (searchMatches.length === 0) {
+        count.innerText = "no match"
+        return
+    }
+    nextSearchMatch(1)
+}
+
+function onSearchKeyDown(e) {
+    if (e.key !== "Enter") {
+        return
+    }
+    e.preventDefault()
+    nextSearchMatch(e.shiftKey ? -1 : 1)
+}
+
+function nextSearchMatch(step) {
+    const n = searchMatches.length
+    if (n === 0) {
+        return
+    }
+    searchIndex = (searchIndex + step + n) % n
+    revealTrace(searchMatches[searchIndex])
+    document.getElementById("search-count").innerText = `${searchIndex + 1}/${n}`
+}
+
+// package filter, a trace is kept if itself
+// or any of its descendants is in the package
+function onChangePkgFilter() {
+    const pkg = document.getElementById("filter-pkg").value
+    const visible = {}
+    for (const id of ids) {
+        if (!pkg || traces[id].FuncInfo?.Pkg === pkg) {
+            visible[id] = true
+            for (const parent of getAncestors(id)) {
+                visible[parent] = true
+            }
+        }
+    }
+    for (const id of ids) {
+        if (!parents[id]) {
+            continue
+        }
+        const li = document.getElementById(getHeadID(id))?.closest("li")
+        if (!li) {
+            continue
+        }
+        if (visible[id]) {
+            li.classList.remove("filtered")
+        } else {
+            li.classList.add("filtered")
+        }
+    }
+    // re-run search to exclude filtered traces
+    onSearchInput()
+}
+
+function onClickNextError() {
+    const n = ids.length
+    const start = ids.indexOf(getSelectedTraceID())
+    for (let i = 1; i <= n; i++) {
+        const id = ids[(start + i + n) % n]
+        const traceData = traces[id]
+        if (!traceData.Error && !traceData.Panic) {
+            continue
+        }
+        if (isFilteredOut(id)) {
+            continue
+        }
+        revealTrace(id)
+        return
+    }
+    alert("no error or panic")
+}
+
+// Begin and End are in nanoseconds
+function onChangeSlowThreshold() {
+    const ms = parseFloat(document.getElementById("slow-threshold").value)
+    for (const id of ids) {
+        const el = document.getElementById(getHeadID(id))
+        if (!el) {
+            continue
+        }
+        const traceData = traces[id]
+        const costMs = ((traceData.End || 0) - (traceData.Begin || 0)) / 1e6
+        if (ms > 0 && costMs >= ms) {
+            el.classList.add("slow")
+        } else {
+            el.classList.remove("slow")
+        }
+    }
+}
+
+const views = ["tree", "flame", "timeline", "top"]
+
+function onClickView(view) {
+    for (const v of views) {
+        const el = document.getElementById(`view-${v}`)
+        const tab = document.getElementById(`view-tab-${v}`)
+        if (v === view) {
+            el?.classList.remove("hidden")
+            tab?.classList.add("active")
+        } else {
+            el?.classList.add("hidden")
+            tab?.classList.remove("active")
+        }
+    }
+}
+
+// show the clicked call in the tree
+function onClickTimeline(id) {
+    onClickView("tree")
+    revealTrace(id)
+}
+
 // for debugging
 window.traces = traces
 window.onClickHead = onClickHead
 window.onClickToggle = onClickToggle
 window.onClickExpandAll = onClickExpandAll
+window.onSearchInput = onSearchInput
+window.onSearchKeyDown = onSearchKeyDown
+window.onChangePkgFilter = onChangePkgFilter
+window.onClickNextError = onClickNextError
+window.onChangeSlowThreshold = onChangeSlowThreshold
+window.onClickView = onClickView
+window.onClickTimeline = onClickTimeline
 
 window.shit = function () {
     debugger
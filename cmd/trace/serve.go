@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultPort = 7070
+
+type serveOptions struct {
+	port   int
+	bind   string
+	noOpen bool
+	// write HTML to this file instead of serving
+	export string
+}
+
+// parseServeFlag parses flags shared by all commands serving pages,
+// returns number of args consumed, 0 if args[i] is not such flag
+func parseServeFlag(args []string, i int, opts *serveOptions) (int, error) {
+	arg := args[i]
+	if arg == "--no-open" {
+		opts.noOpen = true
+		return 1, nil
+	}
+	for _, name := range []string{"--port", "--bind", "--export"} {
+		var val string
+		var consumed int
+		if arg == name {
+			if i+1 >= len(args) {
+				return 0, fmt.Errorf("%s requires value", name)
+			}
+			val = args[i+1]
+			consumed = 2
+		} else if strings.HasPrefix(arg, name+"=") {
+			val = strings.TrimPrefix(arg, name+"=")
+			consumed = 1
+		} else {
+			continue
+		}
+		switch name {
+		case "--port":
+			port, err := strconv.Atoi(val)
+			if err != nil || port < 0 || port > 65535 {
+				return 0, fmt.Errorf("bad --port: %s", val)
+			}
+			opts.port = port
+		case "--bind":
+			opts.bind = val
+		case "--export":
+			if val == "" {
+				return 0, fmt.Errorf("--export requires file")
+			}
+			opts.export = val
+		}
+		return consumed, nil
+	}
+	return 0, nil
+}
+
+// serve renders the page on each request, so
+// that changes of the files are reflected.
+// With --export, the page is rendered once into
+// the file, styles and scripts are all inlined.
+func serve(render func(w io.Writer) error, opts *serveOptions) {
+	if opts.export != "" {
+		err := exportHTML(render, opts.export)
+		if err != nil {
+			exitf("%v", err)
+		}
+		fmt.Printf("Exported %s\n", opts.export)
+		return
+	}
+	server := http.NewServeMux()
+	server.HandleFunc("/", htmlHandler(render))
+	listenAndOpen(server, opts)
+}
+
+func exportHTML(render func(w io.Writer) error, file string) error {
+	var buf bytes.Buffer
+	err := render(&buf)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, buf.Bytes(), 0644)
+}
+
+func htmlHandler(render func(w io.Writer) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if e := recover(); e != nil {
+				stack := debug.Stack()
+				io.WriteString(w, fmt.Sprintf("<pre>panic: %v\n%s</pre>", e, stack))
+			}
+		}()
+		var buf bytes.Buffer
+		err := render(&buf)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, fmt.Sprintf("%v", err))
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write(buf.Bytes())
+	}
+}
+
+func listenAndOpen(server *http.ServeMux, opts *serveOptions) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(opts.bind, strconv.Itoa(opts.port)))
+	if err != nil {
+		exitf("%v", err)
+	}
+	// port may be picked by system
+	port := listener.Addr().(*net.TCPAddr).Port
+	host := opts.bind
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	url := fmt.Sprintf("http://%s", net.JoinHostPort(host, strconv.Itoa(port)))
+	fmt.Printf("Server listen at %s\n", url)
+
+	if !opts.noOpen {
+		go func() {
+			time.Sleep(500 * time.Millisecond)
+			openBrowser(url)
+		}()
+	}
+
+	err = http.Serve(listener, server)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// openBrowser is best effort, servers
+// usually have no browser at all
+func openBrowser(url string) {
+	var name string
+	var args []string
+	switch runtime.GOOS {
+	case "darwin":
+		name = "open"
+	case "windows":
+		name = "cmd"
+		args = []string{"/c", "start"}
+	default:
+		name = "xdg-open"
+	}
+	if _, err := exec.LookPath(name); err != nil {
+		return
+	}
+	cmd := exec.Command(name, append(args, url)...)
+	err := cmd.Start()
+	if err != nil {
+		return
+	}
+	go cmd.Wait()
+}
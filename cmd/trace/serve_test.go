@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseServeFlag(t *testing.T) {
+	args := []string{"--port", "8080", "--bind=127.0.0.1", "--no-open", "--export=out.html", "t.json"}
+	opts := &serveOptions{port: defaultPort}
+	var files []string
+	for i := 0; i < len(args); i++ {
+		consumed, err := parseServeFlag(args, i, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if consumed > 0 {
+			i += consumed - 1
+			continue
+		}
+		files = append(files, args[i])
+	}
+	expect := serveOptions{port: 8080, bind: "127.0.0.1", noOpen: true, export: "out.html"}
+	if *opts != expect {
+		t.Fatalf("expect opts: %+v, actual: %+v", expect, *opts)
+	}
+	if len(files) != 1 || files[0] != "t.json" {
+		t.Fatalf("expect files: [t.json], actual: %v", files)
+	}
+
+	for _, bad := range [][]string{{"--port"}, {"--port=x"}, {"--port=70000"}, {"--export="}} {
+		_, err := parseServeFlag(bad, 0, &serveOptions{})
+		if err == nil {
+			t.Fatalf("expect error for %v", bad)
+		}
+	}
+}
+
+func TestExportHTML(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "t.json")
+	err := os.WriteFile(file, []byte(`{"Children":[{"FuncInfo":{"Pkg":"example.com/demo","IdentityName":"Greet"},"Begin":0,"End":1000}]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "t.html")
+	err = exportHTML(func(w io.Writer) error {
+		root, err := parseRecord(file)
+		if err != nil {
+			return err
+		}
+		renderRecordHTML(root, file, w)
+		return nil
+	}, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := string(data)
+	for _, expect := range []string{"Greet", "onClickHead", ".trace-list"} {
+		if !strings.Contains(html, expect) {
+			t.Fatalf("expect exported html to contain %q", expect)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+func isStreamFile(file string) bool {
+	return strings.HasSuffix(file, ".jsonl")
+}
+
+func parseStreamFile(file string) (*RootExport, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseStream(f)
+}
+
+// parseStream rebuilds the call tree from enter and exit events
+// written by XGO_TRACE_STREAM=true.
+// When calls come from more than one goroutine, top level calls
+// are grouped under one node per goroutine.
+// Calls that have not exited when the stream ends are
+// closed at the time of the last event.
+func parseStream(r io.Reader) (*RootExport, error) {
+	root := &RootExport{}
+	stacks := make(map[int64]*StackExport)
+	var unfinished []*StackExport
+	var gList []string
+	gRoots := make(map[string][]*StackExport)
+	var lastTime int64
+
+	scanner := bufio.NewScanner(r)
+	// args can be large
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		var event StackEvent
+		err := json.Unmarshal(line, &event)
+		if err != nil {
+			// the last line may be truncated if the process was killed
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		if event.Time > lastTime {
+			lastTime = event.Time
+		}
+		switch event.Kind {
+		case "begin":
+			if event.Begin != nil {
+				root.Begin = *event.Begin
+			}
+		case "enter":
+			stack := &StackExport{
+				FuncInfo: event.FuncInfo,
+				Begin:    event.Time,
+				Args:     event.Args,
+				CallFile: event.CallFile,
+				CallLine: event.CallLine,
+				Ctx:      event.Ctx,
+			}
+			stacks[event.ID] = stack
+			unfinished = append(unfinished, stack)
+			parent := stacks[event.ParentID]
+			if event.ParentID == 0 || parent == nil {
+				if _, ok := gRoots[event.G]; !ok {
+					gList = append(gList, event.G)
+				}
+				gRoots[event.G] = append(gRoots[event.G], stack)
+				continue
+			}
+			parent.Children = append(parent.Children, stack)
+		case "exit":
+			stack := stacks[event.ID]
+			if stack == nil {
+				// enter event lost
+				continue
+			}
+			stack.End = event.Time
+			stack.Results = event.Results
+			stack.Panic = event.Panic
+			stack.Error = event.Error
+			// finished calls no longer need to be looked up
+			delete(stacks, event.ID)
+		default:
+			return nil, fmt.Errorf("line %d: unknown event: %s", lineNum, event.Kind)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for _, stack := range unfinished {
+		if stack.End == 0 {
+			stack.End = lastTime
+		}
+	}
+	if root.Begin.IsZero() {
+		root.Begin = time.Now()
+	}
+	if len(gList) == 1 {
+		root.Children = gRoots[gList[0]]
+		return root, nil
+	}
+	for _, g := range gList {
+		children := gRoots[g]
+		gStack := &StackExport{
+			FuncInfo: &FuncInfoExport{
+				IdentityName: "<goroutine " + g + ">",
+			},
+			Begin:    children[0].Begin,
+			End:      children[len(children)-1].End,
+			Children: children,
+		}
+		root.Children = append(root.Children, gStack)
+	}
+	return root, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// go test -run TestParseStream -v ./cmd/trace
+func TestParseStream(t *testing.T) {
+	stream := `{"Kind":"begin","Begin":"2024-03-01T10:00:00Z","Time":0}
+{"Kind":"enter","G":"g_1","ID":1,"Time":10,"FuncInfo":{"Pkg":"main","IdentityName":"main"},"Args":{}}
+{"Kind":"enter","G":"g_1","ID":2,"ParentID":1,"Time":20,"FuncInfo":{"Pkg":"main","IdentityName":"A","FirstArgCtx":true},"Ctx":{"Deadline":"2024-03-01T10:00:01Z","Values":{"user":"alice"}},"Args":{"a":1}}
+{"Kind":"exit","G":"g_1","ID":2,"Time":30,"Results":{"":2}}
+{"Kind":"enter","G":"g_1","ID":3,"ParentID":1,"Time":40,"FuncInfo":{"Pkg":"main","IdentityName":"B"},"Args":{}}
+{"Kind":"exit","G":"g_1","ID":3,"Time":50,"Error":"B failed"}
+`
+	root, err := parseStream(strings.NewReader(stream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(root.Children) != 1 {
+		t.Fatalf("expect 1 root, actual: %d", len(root.Children))
+	}
+	mainStack := root.Children[0]
+	if mainStack.FuncInfo.IdentityName != "main" {
+		t.Fatalf("expect root main, actual: %s", mainStack.FuncInfo.IdentityName)
+	}
+	// main never exited, closed at last event
+	if mainStack.End != 50 {
+		t.Fatalf("expect unfinished main end at 50, actual: %d", mainStack.End)
+	}
+	if len(mainStack.Children) != 2 {
+		t.Fatalf("expect main has 2 children, actual: %d", len(mainStack.Children))
+	}
+	a, b := mainStack.Children[0], mainStack.Children[1]
+	if a.FuncInfo.IdentityName != "A" || a.Begin != 20 || a.End != 30 {
+		t.Fatalf("bad A: %+v", a)
+	}
+	if a.Ctx == nil || a.Ctx.Deadline != "2024-03-01T10:00:01Z" || a.Ctx.Values["user"] != "alice" {
+		t.Fatalf("bad ctx of A: %+v", a.Ctx)
+	}
+	if b.FuncInfo.IdentityName != "B" || b.Error != "B failed" {
+		t.Fatalf("bad B: %+v", b)
+	}
+}
+
+// go test -run TestParseStreamMultipleGoroutines -v ./cmd/trace
+func TestParseStreamMultipleGoroutines(t *testing.T) {
+	stream := `{"Kind":"begin","Begin":"2024-03-01T10:00:00Z","Time":0}
+{"Kind":"enter","G":"g_1","ID":1,"Time":10,"FuncInfo":{"IdentityName":"A"}}
+{"Kind":"enter","G":"g_2","ID":2,"Time":20,"FuncInfo":{"IdentityName":"B"}}
+{"Kind":"exit","G":"g_2","ID":2,"Time":30}
+{"Kind":"exit","G":"g_1","ID":1,"Time":40}
+`
+	root, err := parseStream(strings.NewReader(stream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(root.Children) != 2 {
+		t.Fatalf("expect 2 goroutines, actual: %d", len(root.Children))
+	}
+	g1 := root.Children[0]
+	if g1.FuncInfo.IdentityName != "<goroutine g_1>" || len(g1.Children) != 1 || g1.Children[0].FuncInfo.IdentityName != "A" {
+		t.Fatalf("bad goroutine g_1: %+v", g1)
+	}
+}
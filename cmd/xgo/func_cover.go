@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FuncCover is one function in the --func-cover report
+type FuncCover struct {
+	Func    string // identity name
+	File    string
+	Line    int
+	EndLine int
+	Hit     bool
+}
+
+// PkgCover is the --func-cover report of a package
+type PkgCover struct {
+	Pkg     string
+	Covered int
+	Total   int
+	Funcs   []*FuncCover
+}
+
+// writeFuncCover merges hits written by each test binary,
+// and writes the report to file: JSON if file ends with
+// .json, otherwise a profile accepted by 'go tool cover'
+func writeFuncCover(dir string, projectDir string, file string) error {
+	pkgs, err := mergeFuncCover(dir, getModPath(projectDir))
+	if err != nil {
+		return err
+	}
+	var data []byte
+	if strings.HasSuffix(file, ".json") {
+		data, err = json.MarshalIndent(pkgs, "", "    ")
+		if err != nil {
+			return err
+		}
+	} else {
+		data = []byte(formatCoverProfile(pkgs))
+	}
+	err = ioutil.WriteFile(file, data, 0644)
+	if err != nil {
+		return err
+	}
+	var covered, total int
+	for _, pkg := range pkgs {
+		covered += pkg.Covered
+		total += pkg.Total
+		fmt.Printf("func coverage: %s %d/%d %s\n", pkg.Pkg, pkg.Covered, pkg.Total, formatPercent(pkg.Covered, pkg.Total))
+	}
+	fmt.Printf("func coverage: total %d/%d %s, written to %s\n", covered, total, formatPercent(covered, total), file)
+	return nil
+}
+
+func formatPercent(covered int, total int) string {
+	if total == 0 {
+		return "0.0%"
+	}
+	return fmt.Sprintf("%.1f%%", float64(covered)*100/float64(total))
+}
+
+// mergeFuncCover reads lines of
+//
+//	pkgPath\tidentityName\tfile\tline\tendLine\thit
+//
+// a function is covered if any test binary hits it.
+// Only packages of modPath are kept, std lib and dependencies
+// are registered too but are not interesting.
+func mergeFuncCover(dir string, modPath string) ([]*PkgCover, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	pkgMapping := make(map[string]*PkgCover)
+	funcMapping := make(map[string]*FuncCover)
+	var pkgs []*PkgCover
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		err := readFuncCoverFile(filepath.Join(dir, f.Name()), func(pkgPath string, fn *FuncCover) {
+			// like go cover, test files are not counted
+			if !isModPkg(pkgPath, modPath) || strings.HasSuffix(fn.File, "_test.go") {
+				return
+			}
+			key := pkgPath + "." + fn.Func
+			if prev := funcMapping[key]; prev != nil {
+				prev.Hit = prev.Hit || fn.Hit
+				return
+			}
+			funcMapping[key] = fn
+			pkg := pkgMapping[pkgPath]
+			if pkg == nil {
+				pkg = &PkgCover{Pkg: pkgPath}
+				pkgMapping[pkgPath] = pkg
+				pkgs = append(pkgs, pkg)
+			}
+			pkg.Funcs = append(pkg.Funcs, fn)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(pkgs, func(i, j int) bool {
+		return pkgs[i].Pkg < pkgs[j].Pkg
+	})
+	for _, pkg := range pkgs {
+		sort.Slice(pkg.Funcs, func(i, j int) bool {
+			a, b := pkg.Funcs[i], pkg.Funcs[j]
+			if a.File != b.File {
+				return a.File < b.File
+			}
+			return a.Line < b.Line
+		})
+		pkg.Total = len(pkg.Funcs)
+		for _, fn := range pkg.Funcs {
+			if fn.Hit {
+				pkg.Covered++
+			}
+		}
+	}
+	return pkgs, nil
+}
+
+func readFuncCoverFile(file string, f func(pkgPath string, fn *FuncCover)) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 6 {
+			continue
+		}
+		line, _ := strconv.Atoi(fields[3])
+		endLine, _ := strconv.Atoi(fields[4])
+		f(fields[0], &FuncCover{
+			Func:    fields[1],
+			File:    fields[2],
+			Line:    line,
+			EndLine: endLine,
+			Hit:     fields[5] == "true",
+		})
+	}
+	return scanner.Err()
+}
+
+func isModPkg(pkgPath string, modPath string) bool {
+	if pkgPath == "main" {
+		return true
+	}
+	if modPath == "" {
+		// std lib has no dot in the first element
+		first := pkgPath
+		if idx := strings.Index(pkgPath, "/"); idx >= 0 {
+			first = pkgPath[:idx]
+		}
+		return strings.Contains(first, ".")
+	}
+	pkgPath = strings.TrimSuffix(pkgPath, "_test")
+	return pkgPath == modPath || strings.HasPrefix(pkgPath, modPath+"/")
+}
+
+// formatCoverProfile makes each function a block, so
+// 'go tool cover -html' colors whole functions
+func formatCoverProfile(pkgs []*PkgCover) string {
+	var b strings.Builder
+	b.WriteString("mode: set\n")
+	for _, pkg := range pkgs {
+		for _, fn := range pkg.Funcs {
+			if fn.File == "" || fn.Line == 0 {
+				continue
+			}
+			count := 0
+			if fn.Hit {
+				count = 1
+			}
+			endLine := fn.EndLine
+			if endLine < fn.Line {
+				endLine = fn.Line
+			}
+			// cover resolves import path style names with go list,
+			// main has no import path
+			file := fn.File
+			if pkg.Pkg != "main" {
+				file = path.Join(strings.TrimSuffix(pkg.Pkg, "_test"), filepath.Base(fn.File))
+			}
+			fmt.Fprintf(&b, "%s:%d.1,%d.2 1 %d\n", file, fn.Line, endLine, count)
+		}
+	}
+	return b.String()
+}
+
+func getModPath(projectDir string) string {
+	dir := projectDir
+	if dir == "" {
+		dir = "."
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "module ") {
+			return strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "module ")), `"`)
+		}
+	}
+	return ""
+}
@@ -25,8 +25,16 @@ Examples:
     xgo buil -o main -gcflags="all=-N -l" ./     build current module with debug flags
     xgo run ./                                   run current module
     xgo test ./...                               test all test cases of current module
+    xgo test --func-cover=cover.out ./...        report functions entered by tests
+    xgo test --fault-config=fault.json ./...     inject faults by rules in fault.json
+    xgo test --deterministic-maps=1 ./...        fix map iteration order by seed 1
+    xgo test --mock-clock ./...                  allow runtime/mockclock to drive time funcs
     xgo exec go version                          print instrumented go version
     xgo tool trace   TestSomething.json          view test trace
+    xgo tool trace   ./trace_20240301_100000     browse traces in a directory
+    xgo tool trace   diff old.json new.json      compare two traces
+    xgo tool trace   --export out.html t.json    export trace as static HTML
+    xgo tool trace   export t.json               convert trace to folded stacks
 
 See https://github.com/xhd2015/xgo for documentation.
 
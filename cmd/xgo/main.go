@@ -117,10 +117,47 @@ func handleBuild(cmd string, args []string) error {
 	gcflags := opts.gcflags
 	withGoroot := opts.withGoroot
 	dumpIR := opts.dumpIR
+	funcCover := opts.funcCover
+	faultConfig := opts.faultConfig
+	deterministicMaps := opts.deterministicMaps
+	mockClock := opts.mockClock
 
 	if cmdExec && len(remainArgs) == 0 {
 		return fmt.Errorf("exec requires command")
 	}
+	if funcCover != "" && (cmd != "test" || noInstrument) {
+		return fmt.Errorf("--func-cover requires instrumented test")
+	}
+	if faultConfig != "" {
+		if cmd != "test" || noInstrument {
+			return fmt.Errorf("--fault-config requires instrumented test")
+		}
+		// test binaries run in package directories
+		absFaultConfig, err := filepath.Abs(faultConfig)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(absFaultConfig); err != nil {
+			return fmt.Errorf("--fault-config: %w", err)
+		}
+		faultConfig = absFaultConfig
+	}
+	if deterministicMaps {
+		if cmdExec || noInstrument {
+			return fmt.Errorf("--deterministic-maps requires instrumented build")
+		}
+		mapSeed, err := getMapSeed(opts.mapSeed)
+		if err != nil {
+			return err
+		}
+		// read by the runtime before any map is created
+		remainArgs = addLdflags(remainArgs, fmt.Sprintf("-X runtime.__xgo_map_seed=%d", mapSeed))
+		fmt.Fprintf(os.Stderr, "xgo: deterministic maps, seed: %d, reproduce with --deterministic-maps=%d\n", mapSeed, mapSeed)
+	}
+
+	if mockClock && (cmdExec || noInstrument) {
+		return fmt.Errorf("--mock-clock requires instrumented build")
+	}
 
 	goroot, err := checkGoroot(withGoroot)
 	if err != nil {
@@ -143,6 +180,15 @@ func handleBuild(cmd string, args []string) error {
 		}
 	}
 
+	var funcCoverDir string
+	if funcCover != "" {
+		funcCoverDir = filepath.Join(tmpDir, "func-cover")
+		err := os.MkdirAll(funcCoverDir, 0755)
+		if err != nil {
+			return err
+		}
+	}
+
 	var tmpIRFile string
 	if !noInstrument {
 		if dumpIR != "" {
@@ -177,6 +223,11 @@ func handleBuild(cmd string, args []string) error {
 	compilerBuildID := filepath.Join(instrumentDir, "compile.buildid.txt")
 	instrumentGoroot := filepath.Join(instrumentDir, goVersionName)
 	buildCacheDir := filepath.Join(instrumentDir, "build-cache")
+	if mockClock {
+		// std packages are compiled differently, but the
+		// env is not part of the cache key of go
+		buildCacheDir = filepath.Join(instrumentDir, "build-cache-mock-clock")
+	}
 	revisionFile := filepath.Join(instrumentDir, "xgo-revision.txt")
 
 	var realXgoSrc string
@@ -307,6 +358,16 @@ func handleBuild(cmd string, args []string) error {
 		if vscodeDebugFile != "" {
 			execCmd.Env = append(execCmd.Env, "XGO_DEBUG_VSCODE="+vscodeDebugFile+vscodeDebugFileSuffix)
 		}
+		if funcCoverDir != "" {
+			execCmd.Env = append(execCmd.Env, "XGO_FUNC_COVER="+funcCoverDir)
+		}
+		if faultConfig != "" {
+			execCmd.Env = append(execCmd.Env, "XGO_FAULT_CONFIG="+faultConfig)
+		}
+		if mockClock {
+			// read by the compiler, see stdTrapFuncs in patch/trap.go
+			execCmd.Env = append(execCmd.Env, "XGO_MOCK_CLOCK=true")
+		}
 	}
 	execCmd.Stdout = os.Stdout
 	execCmd.Stderr = os.Stderr
@@ -314,6 +375,13 @@ func handleBuild(cmd string, args []string) error {
 		execCmd.Dir = projectDir
 	}
 	err = execCmd.Run()
+	if funcCoverDir != "" {
+		// failed tests still have coverage
+		coverErr := writeFuncCover(funcCoverDir, projectDir, funcCover)
+		if coverErr != nil && err == nil {
+			err = coverErr
+		}
+	}
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// getMapSeed parses the seed of --deterministic-maps=<seed>,
+// or picks a random one. Seeds are limited to int32 so that
+// the runtime can parse it on 32-bit platforms.
+func getMapSeed(seed string) (int32, error) {
+	if seed == "" {
+		return rand.New(rand.NewSource(time.Now().UnixNano())).Int31(), nil
+	}
+	n, err := strconv.ParseInt(seed, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("--deterministic-maps: invalid seed %q, expect a 32-bit integer", seed)
+	}
+	return int32(n), nil
+}
+
+// addLdflags appends flags to -ldflags in args, because go
+// only respects the last -ldflags. Args after -args are
+// passed to the test binary so they are left untouched.
+func addLdflags(args []string, flags string) []string {
+	n := len(args)
+	for i, arg := range args {
+		if arg == "-args" {
+			n = i
+			break
+		}
+	}
+	res := make([]string, 0, len(args)+1)
+	var ldflags string
+	for i := 0; i < n; i++ {
+		arg := args[i]
+		if strings.HasPrefix(arg, "-ldflags=") {
+			ldflags = strings.TrimPrefix(arg, "-ldflags=")
+			continue
+		}
+		if arg == "-ldflags" && i+1 < n {
+			ldflags = args[i+1]
+			i++
+			continue
+		}
+		res = append(res, arg)
+	}
+	if ldflags != "" {
+		flags = ldflags + " " + flags
+	}
+	// before packages
+	res = append([]string{"-ldflags=" + flags}, res...)
+	return append(res, args[n:]...)
+}
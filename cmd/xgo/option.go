@@ -38,6 +38,16 @@ type options struct {
 	// -gcflags
 	gcflags string
 
+	// write function coverage to this file
+	funcCover string
+	// rules of runtime/fault, see XGO_FAULT_CONFIG
+	faultConfig string
+	// fix map iteration order, random seed if mapSeed is empty
+	deterministicMaps bool
+	mapSeed           string
+	// trap time funcs of std lib for runtime/mockclock
+	mockClock bool
+
 	remainArgs []string
 }
 
@@ -70,6 +80,12 @@ func parseOptions(args []string) (*options, error) {
 
 	var gcflags string
 
+	var funcCover string
+	var faultConfig string
+	var deterministicMaps bool
+	var mapSeed string
+	var mockClock bool
+
 	var remainArgs []string
 	nArg := len(args)
 
@@ -111,6 +127,14 @@ func parseOptions(args []string) (*options, error) {
 			Flags: []string{"-gcflags"},
 			Value: &gcflags,
 		},
+		{
+			Flags: []string{"--func-cover"},
+			Value: &funcCover,
+		},
+		{
+			Flags: []string{"--fault-config"},
+			Value: &faultConfig,
+		},
 	}
 	for i := 0; i < nArg; i++ {
 		arg := args[i]
@@ -178,6 +202,20 @@ func parseOptions(args []string) (*options, error) {
 			noSetup = true
 			continue
 		}
+		if arg == "--mock-clock" {
+			mockClock = true
+			continue
+		}
+		// the seed is optional, so only --deterministic-maps=<seed>
+		if arg == "--deterministic-maps" {
+			deterministicMaps = true
+			continue
+		}
+		if strings.HasPrefix(arg, "--deterministic-maps=") {
+			deterministicMaps = true
+			mapSeed = strings.TrimPrefix(arg, "--deterministic-maps=")
+			continue
+		}
 		var found bool
 		for _, flagVal := range flagValues {
 			ok, err := flag.TryParseFlagsValue(flagVal.Flags, flagVal.Value, &i, args)
@@ -244,6 +282,12 @@ func parseOptions(args []string) (*options, error) {
 
 		gcflags: gcflags,
 
+		funcCover:         funcCover,
+		faultConfig:       faultConfig,
+		deterministicMaps: deterministicMaps,
+		mapSeed:           mapSeed,
+		mockClock:         mockClock,
+
 		remainArgs: remainArgs,
 	}, nil
 }
@@ -54,6 +54,14 @@ func patchRuntimeAndTesting(goroot string) error {
 	if err != nil {
 		return err
 	}
+	err = patchTimeSleep(goroot)
+	if err != nil {
+		return err
+	}
+	err = patchRuntimeMap(goroot)
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -69,6 +77,20 @@ func patchRuntimeProc(goroot string) error {
 	err := editFile(procGo, func(content string) (string, error) {
 		content = addContentAfter(content, "/*<begin set_init_finished_mark>*/", "/*<end set_init_finished_mark>*/", anchors, patch.RuntimeProcPatch)
 
+		// maps must not be used before alginit
+		content = addContentAfter(content,
+			"/*<begin init_map_seed>*/", "/*<end init_map_seed>*/",
+			[]string{"func schedinit() {", "alginit()", "\n"},
+			patch.RuntimeMapSeedPatch,
+		)
+
+		// env is read once, before any function is trapped
+		content = addContentAfter(content,
+			"/*<begin init_func_cover>*/", "/*<end init_func_cover>*/",
+			[]string{"func schedinit() {", "goenvs()", "\n"},
+			patch.RuntimeFuncCoverPatch,
+		)
+
 		// goexit1() is called for every exited goroutine
 		content = addContentAfter(content,
 			"/*<begin add_go_exit_callback>*/", "/*<end add_go_exit_callback>*/",
@@ -98,9 +120,81 @@ func patchRuntimeTesting(goroot string) error {
 			anchor,
 			patch.TestingStart,
 		)
+
+		// func (m *M) Run() (code int) {
+		runAnchor := []string{"func (m *M) Run() (code int)", "{", "\n"}
+		content = addContentBefore(content,
+			"/*<begin declare_func_cover>*/", "/*<end declare_func_cover>*/",
+			runAnchor,
+			patch.TestingFuncCover,
+		)
+		content = addContentAfter(content,
+			"/*<begin call_func_cover>*/", "/*<end call_func_cover>*/",
+			runAnchor,
+			patch.TestingMainRun,
+		)
+		return content, nil
+	})
+}
+
+// patchRuntimeMap makes map hash seeds and iteration start
+// fixed when runtime.__xgo_map_seed is set
+func patchRuntimeMap(goroot string) error {
+	mapGo := filepath.Join(goroot, "src", "runtime", "map.go")
+	return editFile(mapGo, func(content string) (string, error) {
+		// every map gets its hash seed by one of these,
+		// fastrand() before go1.22
+		hashSeeds := []string{"fastrand()", "uint32(rand())"}
+		found := strings.Contains(content, "h.hash0 = __xgo_map_hash0(")
+		for _, hashSeed := range hashSeeds {
+			stmt := "h.hash0 = " + hashSeed
+			if !strings.Contains(content, stmt) {
+				continue
+			}
+			content = strings.ReplaceAll(content, stmt, "h.hash0 = __xgo_map_hash0("+hashSeed+")")
+			found = true
+		}
+		if !found {
+			return "", fmt.Errorf("hash seed not found in %s", mapGo)
+		}
+		content = addContentBefore(content,
+			"/*<begin map_iter_start>*/", "/*<end map_iter_start>*/",
+			[]string{"it.startBucket = r & bucketMask(h.B)"},
+			patch.RuntimeMapIterStartPatch,
+		)
 		return content, nil
 	})
 }
+
+// time.Sleep is implemented by runtime.timeSleep via linkname,
+// so it has no body to insert trap into. Give it a body calling
+// __xgo_sleep and move the linkname there.
+func patchTimeSleep(goroot string) error {
+	timeGo := filepath.Join(goroot, "src", "runtime", "time.go")
+	err := editFile(timeGo, func(content string) (string, error) {
+		content = replaceContentAfter(content,
+			"/*<begin link_time_sleep>*/", "/*<end link_time_sleep>*/",
+			[]string{"// timeSleep puts the current goroutine to sleep", "\n"},
+			"//go:linkname timeSleep time.Sleep",
+			patch.RuntimeTimeSleepLink,
+		)
+		return content, nil
+	})
+	if err != nil {
+		return err
+	}
+	sleepGo := filepath.Join(goroot, "src", "time", "sleep.go")
+	return editFile(sleepGo, func(content string) (string, error) {
+		content = replaceContentAfter(content,
+			"/*<begin define_time_sleep>*/", "/*<end define_time_sleep>*/",
+			[]string{"// A negative or zero duration causes Sleep to return immediately.", "\n"},
+			"func Sleep(d Duration)\n",
+			patch.TimeSleepPatch,
+		)
+		return content, nil
+	})
+}
+
 func importCompileInternalPatch(goroot string, xgoSrc string, revisionChanged bool, syncWithLink bool) error {
 	dstDir := filepath.Join(goroot, "src", "cmd", "compile", "internal", "xgo_rewrite_internal", "patch")
 	if isDevelopment {
@@ -281,13 +375,10 @@ func addRuntimeFunctions(goroot string, goVersion *goinfo.GoVersion, xgoSrc stri
 	if goVersion.Major == 1 && goVersion.Minor <= 17 {
 		entryPatch := "fn.entry() /*>=go1.18*/"
 		entryPatchBytes := []byte(entryPatch)
-		idx := bytes.Index(content, entryPatchBytes)
-		if idx < 0 {
+		if !bytes.Contains(content, entryPatchBytes) {
 			return false, fmt.Errorf("expect %q in xgo_trap.go, actually not found", entryPatch)
 		}
-		oldContent := content
-		content = append(content[:idx], []byte("fn.entry")...)
-		content = append(content, oldContent[idx+len(entryPatchBytes):]...)
+		content = bytes.ReplaceAll(content, entryPatchBytes, []byte("fn.entry"))
 	}
 
 	// TODO: remove the patch
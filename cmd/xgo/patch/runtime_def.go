@@ -1,6 +1,7 @@
 package patch
 
 const RuntimeProcPatch = `__xgo_is_init_finished = true
+__xgo_freeze_func_index()
 for _, fn := range __xgo_on_init_finished_callbacks {
 	fn()
 }
@@ -18,11 +19,55 @@ const TestingCallbackDeclarations = `func __xgo_link_get_test_starts() []interfa
 }
 `
 
+// written by each test binary, merged by 'xgo test --func-cover'
+const TestingFuncCover = `func __xgo_link_for_each_func_cover(f func(pkgPath string, identityName string, file string, line int, endLine int, hit bool)) {
+	// link by compiler
+}
+
+func __xgo_write_func_cover() {
+	dir := os.Getenv("XGO_FUNC_COVER")
+	if dir == "" {
+		return
+	}
+	var b strings.Builder
+	__xgo_link_for_each_func_cover(func(pkgPath string, identityName string, file string, line int, endLine int, hit bool) {
+		fmt.Fprintf(&b, "%s\t%s\t%s\t%d\t%d\t%v\n", pkgPath, identityName, file, line, endLine, hit)
+	})
+	file := fmt.Sprintf("%s%c%d_%d.txt", dir, os.PathSeparator, os.Getpid(), time.Now().UnixNano())
+	err := os.WriteFile(file, []byte(b.String()), 0644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "xgo: write func cover: %v\n", err)
+	}
+}
+`
+
+const TestingMainRun = `defer __xgo_write_func_cover()
+`
+
 const TestingStart = `for _,__xgo_on_test_start:=range __xgo_link_get_test_starts(){
 	(__xgo_on_test_start.(func(*T,func(*T))))(t,fn)
 }
 `
 
+// added after alginit() in schedinit
+const RuntimeMapSeedPatch = `__xgo_init_map_seed()`
+
+// added after goenvs() in schedinit
+const RuntimeFuncCoverPatch = `__xgo_init_func_cover()`
+
+// added before mapiterinit picks the start bucket
+const RuntimeMapIterStartPatch = `r = __xgo_map_iter_start(r)`
+
+// time.Sleep gets a body so it can be trapped
+const RuntimeTimeSleepLink = `//go:linkname timeSleep time.__xgo_sleep`
+
+const TimeSleepPatch = `func Sleep(d Duration) {
+	__xgo_sleep(d)
+}
+
+// implemented by runtime.timeSleep
+func __xgo_sleep(d Duration)`
+
 const RuntimeFuncNamePatch = ""
 
 // Not used because now we pass pkg name, func name as standalone strings
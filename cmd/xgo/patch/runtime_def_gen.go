@@ -6,12 +6,25 @@ package patch
 const RuntimeExtraDef = `
 // xgo
 func __xgo_getcurg() unsafe.Pointer
+func __xgo_set_trap_match(match func(pc uintptr) bool)
+func __xgo_trap_enabled() bool
+func __xgo_add_trap_active(n int32)
+func __xgo_enable_trap_callsite()
 func __xgo_trap(pkgPath string, identityName string, generic bool, recv interface{}, args []interface{}, results []interface{}) (func(), bool)
-func __xgo_set_trap(trap func(pkgPath string, identityName string, generic bool, pc uintptr, recv interface{}, args []interface{}, results []interface{}) (func(), bool))
-func __xgo_register_func(pkgPath string, fn interface{}, recvTypeName string, recvPtr bool, name string, identityName string, generic bool, recvName string, argNames []string, resNames []string, firstArgCtx bool, lastResErr bool)
-func __xgo_for_each_func(f func(pkgPath string, recvTypeName string, recvPtr bool, name string, identityName string, generic bool, pc uintptr, fn interface{}, recvName string, argNames []string, resNames []string, firstArgCtx bool, lastResErr bool))
+func __xgo_set_trap(trap func(pkgPath string, identityName string, generic bool, pc uintptr, callerPC uintptr, recv interface{}, args []interface{}, results []interface{}) (func(), bool))
+func __xgo_register_func(pkgPath string, fn interface{}, recvTypeName string, recvPtr bool, name string, identityName string, generic bool, recvName string, argNames []string, resNames []string, firstArgCtx bool, lastResErr bool, file string, line int, endLine int)
+func __xgo_for_each_func(f func(pkgPath string, recvTypeName string, recvPtr bool, name string, identityName string, generic bool, pc uintptr, fn interface{}, recvName string, argNames []string, resNames []string, firstArgCtx bool, lastResErr bool, file string, line int, endLine int))
+func __xgo_init_func_cover()
+func __xgo_func_cover_on() bool
+func __xgo_freeze_func_index()
+func __xgo_record_hit(pkgPath string, identityName string)
+func __xgo_for_each_func_cover(f func(pkgPath string, identityName string, file string, line int, endLine int, hit bool))
 func __xgo_init_finished() bool
 func __xgo_on_init_finished(fn func())
 func __xgo_on_goexit(fn func())
 func __xgo_on_test_start(fn interface{})
-func __xgo_get_test_starts() []interface{}`
\ No newline at end of file
+func __xgo_get_test_starts() []interface{}
+func __xgo_init_map_seed()
+func __xgo_map_next(x *uint64) uint64
+func __xgo_map_hash0(hash0 uint32) uint32
+func __xgo_map_iter_start(r uintptr) uintptr`
\ No newline at end of file
@@ -3,8 +3,8 @@ package main
 import "fmt"
 
 const VERSION = "1.0.2"
-const REVISION = "1030fb3582b5855454eb4c752f8d4c0aec7db6ee+1"
-const NUMBER = 83
+const REVISION = "8b17f5fc95d1c7536b1af668f2bf7d82ccb5251d+1"
+const NUMBER = 90
 
 func getRevision() string {
 	return fmt.Sprintf("%s %s BUILD_%d", VERSION, REVISION, NUMBER)
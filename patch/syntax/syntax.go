@@ -11,7 +11,7 @@ import (
 	xgo_func_name "cmd/compile/internal/xgo_rewrite_internal/patch/func_name"
 )
 
-const sig_expected__xgo_register_func = "func(pkgPath string, fn interface{}, recvTypeName string, recvPtr bool, name string, identityName string, generic bool, recvName string, argNames []string, resNames []string, firstArgCtx bool, lastResErr bool)"
+const sig_expected__xgo_register_func = "func(pkgPath string, fn interface{}, recvTypeName string, recvPtr bool, name string, identityName string, generic bool, recvName string, argNames []string, resNames []string, firstArgCtx bool, lastResErr bool, file string, line int, endLine int)"
 
 func init() {
 	if sig_gen__xgo_register_func != sig_expected__xgo_register_func {
@@ -158,6 +158,11 @@ type DeclInfo struct {
 	ResNames     []string
 	FirstArgCtx  bool
 	LastResError bool
+
+	// source position
+	File    string
+	Line    int
+	EndLine int
 }
 
 func (c *DeclInfo) RefName() string {
@@ -238,6 +243,12 @@ func getRegFuncsBody(files []*syntax.File) ([]*DeclInfo, string) {
 			if len(fn.Type.ResultList) > 0 && isName(fn.Type.ResultList[len(fn.Type.ResultList)-1].Type, "error") {
 				lastResErr = true
 			}
+			pos := fn.Pos()
+			line := int(pos.Line())
+			endLine := line
+			if fn.Body != nil {
+				endLine = int(fn.Body.Rbrace.Line())
+			}
 
 			declFuncs = append(declFuncs, &DeclInfo{
 				FuncDecl:     fn,
@@ -252,6 +263,10 @@ func getRegFuncsBody(files []*syntax.File) ([]*DeclInfo, string) {
 
 				FirstArgCtx:  firstArgCtx,
 				LastResError: lastResErr,
+
+				File:    pos.RelFilename(),
+				Line:    line,
+				EndLine: endLine,
 			})
 		}
 	}
@@ -263,7 +278,7 @@ func getRegFuncsBody(files []*syntax.File) ([]*DeclInfo, string) {
 			continue
 		}
 		refName, _ := declFunc.RefAndGeneric()
-		// pkgPath string, fn interface{}, recvTypeName string, recvPtr bool, name string,identityName string, generic bool, recvName string, argNames []string, resNames []string, firstArgCtx bool, lastResErr bool
+		// pkgPath string, fn interface{}, recvTypeName string, recvPtr bool, name string,identityName string, generic bool, recvName string, argNames []string, resNames []string, firstArgCtx bool, lastResErr bool, file string, line int, endLine int
 		stmts = append(stmts, fmt.Sprintf("__xgo_reg_func(__xgo_regPkgPath,%s)",
 			strings.Join([]string{
 				refName,
@@ -271,6 +286,7 @@ func getRegFuncsBody(files []*syntax.File) ([]*DeclInfo, string) {
 				strconv.Quote(declFunc.IdentityName()), strconv.FormatBool(declFunc.Generic), // generic
 				strconv.Quote(declFunc.RecvName), quoteNamesExpr(declFunc.ArgNames), quoteNamesExpr(declFunc.ResNames),
 				strconv.FormatBool(declFunc.FirstArgCtx), strconv.FormatBool(declFunc.LastResError),
+				strconv.Quote(declFunc.File), strconv.Itoa(declFunc.Line), strconv.Itoa(declFunc.EndLine),
 			},
 				",",
 			),
@@ -51,18 +51,48 @@ const xgoRuntimeTrapPkg = xgoRuntimePkgPrefix + "trap"
 const xgoOnTestStart = "__xgo_on_test_start"
 
 const setTrap = "__xgo_set_trap"
+const setTrapMatch = "__xgo_set_trap_match"
 
 var linkMap = map[string]string{
-	"__xgo_link_for_each_func":    "__xgo_for_each_func",
-	"__xgo_link_getcurg":          "__xgo_getcurg",
-	"__xgo_link_set_trap":         setTrap,
-	"__xgo_link_init_finished":    "__xgo_init_finished",
-	"__xgo_link_on_init_finished": "__xgo_on_init_finished",
-	"__xgo_link_on_goexit":        "__xgo_on_goexit",
-	"__xgo_link_on_test_start":    xgoOnTestStart,
-	"__xgo_link_get_test_starts":  "__xgo_get_test_starts",
+	"__xgo_link_for_each_func":        "__xgo_for_each_func",
+	"__xgo_link_getcurg":              "__xgo_getcurg",
+	"__xgo_link_set_trap":             setTrap,
+	"__xgo_link_set_trap_match":       setTrapMatch,
+	"__xgo_link_add_trap_active":      "__xgo_add_trap_active",
+	"__xgo_link_enable_trap_callsite": "__xgo_enable_trap_callsite",
+	"__xgo_link_init_finished":        "__xgo_init_finished",
+	"__xgo_link_on_init_finished":     "__xgo_on_init_finished",
+	"__xgo_link_on_goexit":            "__xgo_on_goexit",
+	"__xgo_link_on_test_start":        xgoOnTestStart,
+	"__xgo_link_get_test_starts":      "__xgo_get_test_starts",
+
+	"__xgo_link_for_each_func_cover": "__xgo_for_each_func_cover",
 }
 
+// std funcs that are trapped despite base.Flag.Std when
+// XGO_MOCK_CLOCK is set by xgo --mock-clock, used by
+// runtime/mockclock. time.Sleep has no body until cmd/xgo
+// patches it, see patchTimeSleep
+var stdTrapFuncs = map[string]map[string]bool{
+	"time": {
+		"Now":             true,
+		"Since":           true,
+		"Until":           true,
+		"Sleep":           true,
+		"After":           true,
+		"AfterFunc":       true,
+		"Tick":            true,
+		"NewTimer":        true,
+		"NewTicker":       true,
+		"(*Timer).Stop":   true,
+		"(*Timer).Reset":  true,
+		"(*Ticker).Stop":  true,
+		"(*Ticker).Reset": true,
+	},
+}
+
+var mockClock = os.Getenv("XGO_MOCK_CLOCK") == "true"
+
 var inited bool
 var intfSlice *types.Type
 
@@ -132,7 +162,7 @@ func CanInsertTrapOrLink(fn *ir.Func) (string, bool) {
 		}
 		// ir.Dump("before:", fn)
 		if !disableXgoLink {
-			if linkName == setTrap && pkgPath != xgoRuntimeTrapPkg {
+			if (linkName == setTrap || linkName == setTrapMatch) && pkgPath != xgoRuntimeTrapPkg {
 				return "", false
 			}
 			return linkName, false
@@ -160,7 +190,9 @@ func CanInsertTrapOrLink(fn *ir.Func) (string, bool) {
 		// NOTE: base.Flag.Std in does not always reflect func's package path,
 		// because generic instantiation happens in other package, so this
 		// func may be a foreigner.
-		return "", false
+		if !mockClock || !stdTrapFuncs[pkgPath][fnName] {
+			return "", false
+		}
 	}
 	if !canInsertTrap(fn) {
 		return "", false
@@ -206,7 +238,11 @@ func CanInsertTrapOrLink(fn *ir.Func) (string, bool) {
 	}
 	==>
 	func orig_trap(a string) (err error) {
-		after,stop := __trap(nil,[]interface{}{&a},[]interface{}{&err})
+		var after func()
+		var stop bool
+		if __xgo_trap_enabled() {
+			after,stop = __trap(nil,[]interface{}{&a},[]interface{}{&err})
+		}
 		if stop {
 		}else{
 			if after!=nil{
@@ -216,6 +252,13 @@ func CanInsertTrapOrLink(fn *ir.Func) (string, bool) {
 			return nil
 		}
 	}
+
+	NOTE: because &a and &err are taken, escape analysis moves
+	params and results to the heap at function entry, even when
+	the branch is not taken. So a trapped function costs up to one
+	allocation per param and result, with or without interceptors.
+	Copying them to locals of the branch would avoid this for params,
+	but not for results, which Post reads after the body returns.
 */
 
 // for go1.17,go1.18
@@ -310,14 +353,26 @@ func InsertTrapForFunc(fn *ir.Func, forGeneric bool) bool {
 		callTrap.SetType(getFuncResultsType(trap.Type()))
 	}
 
+	// declare after and stop first, they stay zero when trap is
+	// not enabled, so the args slices are not built at all
+	declAfter := ir.NewAssignStmt(fnPos, afterV, nil)
+	declAfter.Def = true
+	declStop := ir.NewAssignStmt(fnPos, stopV, nil)
+	declStop.Def = true
+
 	callAssign := ir.NewAssignListStmt(fnPos, ir.OAS2, []ir.Node{afterV, stopV}, []ir.Node{callTrap})
-	callAssign.Def = true
 
 	var assignStmt ir.Node = callAssign
 	if false {
 		assignStmt = callTrap
 	}
 
+	trapEnabled := ir.NewCallExpr(fnPos, ir.OCALL, typecheck.LookupRuntime("__xgo_trap_enabled"), nil)
+	if genericTrapNeedsWorkaround && forGeneric {
+		trapEnabled.SetType(types.Types[types.TBOOL])
+	}
+	ifEnabled := ir.NewIfStmt(fnPos, trapEnabled, []ir.Node{assignStmt}, nil)
+
 	bin := ir.NewBinaryExpr(fnPos, ir.ONE, afterV, NewNilExpr(fnPos, afterV.Type()))
 	if forGeneric {
 		// only generic needs explicit type
@@ -336,7 +391,7 @@ func InsertTrapForFunc(fn *ir.Func, forGeneric bool) bool {
 	}
 	ifStmt := ir.NewIfStmt(fnPos, stopV, nil, newBody)
 
-	fn.Body = []ir.Node{assignStmt, ifStmt}
+	fn.Body = []ir.Node{declAfter, declStop, ifEnabled, ifStmt}
 	return true
 }
 
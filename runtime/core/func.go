@@ -17,8 +17,9 @@ type FuncInfo struct {
 	Generic bool
 
 	// source info
-	File string
-	Line int
+	File    string
+	Line    int
+	EndLine int
 
 	PC       uintptr     `json:"-"`
 	Func     interface{} `json:"-"`
@@ -12,6 +12,15 @@ type ObjectWithErr interface {
 	GetErr() Field
 }
 
+// ObjectWithCtx is implemented by args of functions whose
+// first argument is a context.Context, the ctx is not
+// counted by NumField, but can be read or replaced by GetCtx
+type ObjectWithCtx interface {
+	Object
+
+	GetCtx() Field
+}
+
 type Field interface {
 	Name() string
 	Value() interface{}
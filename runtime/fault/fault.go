@@ -0,0 +1,279 @@
+package fault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xhd2015/xgo/runtime/core"
+	"github.com/xhd2015/xgo/runtime/trap"
+)
+
+const __XGO_SKIP_TRAP = true
+
+type Action string
+
+const (
+	// ActionError makes the function return an error without running
+	// it, only applies to functions whose last result is error
+	ActionError Action = "error"
+	// ActionDelay sleeps before running the function
+	ActionDelay Action = "delay"
+	// ActionPanic panics instead of running the function
+	ActionPanic Action = "panic"
+	// ActionCorrupt sets results other than error to zero values
+	// after the function returns
+	ActionCorrupt Action = "corrupt"
+)
+
+const defaultMessage = "fault: injected by xgo"
+
+// ErrInjected is returned by ActionError
+// if the rule has no Message
+var ErrInjected = errors.New(defaultMessage)
+
+// Rule decides which calls get a fault, a call must satisfy all
+// conditions set. For example:
+//
+//	{"func": "github.com/my/pkg.(*Client).*", "action": "error", "probability": 0.1}
+type Rule struct {
+	// Func matches "<pkg>.<identity name>" of the function, e.g.
+	// "github.com/my/pkg.(*Client).Get", or just the identity name.
+	// '*' matches any characters.
+	Func string `json:"func"`
+	// Probability of injecting, 0 means always
+	Probability float64 `json:"probability,omitempty"`
+	// Nth only injects into the nth matching call, starting from 1
+	Nth int64 `json:"nth,omitempty"`
+	// CtxKey only injects when the first context.Context argument
+	// has a value for it, strings when loaded from config
+	CtxKey interface{} `json:"ctxKey,omitempty"`
+
+	Action Action `json:"action"`
+	// Message of the error or panic
+	Message string `json:"message,omitempty"`
+	// Delay of ActionDelay, like "100ms" in config
+	Delay Duration `json:"delay,omitempty"`
+
+	calls int64
+}
+
+// Duration is a time.Duration written as "100ms" in JSON
+type Duration time.Duration
+
+func (c Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(c).String())
+}
+
+func (c *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		// plain nanoseconds
+		var n int64
+		if numErr := json.Unmarshal(data, &n); numErr != nil {
+			return err
+		}
+		*c = Duration(n)
+		return nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*c = Duration(d)
+	return nil
+}
+
+var randMutex sync.Mutex
+var random = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// SetSeed makes probabilities reproducible
+func SetSeed(seed int64) {
+	randMutex.Lock()
+	random = rand.New(rand.NewSource(seed))
+	randMutex.Unlock()
+}
+
+func randFloat() float64 {
+	randMutex.Lock()
+	defer randMutex.Unlock()
+	return random.Float64()
+}
+
+// Add injects faults into trapped functions of all
+// goroutines according to rules, the first matching
+// rule of a call wins. The returned func removes them.
+// Add panics if a rule is invalid.
+func Add(rules ...*Rule) func() {
+	for _, rule := range rules {
+		if err := rule.validate(); err != nil {
+			panic(err)
+		}
+	}
+	return trap.AddGlobalInterceptor(&trap.Interceptor{
+		Phase: trap.PhaseModify,
+		Pre: func(ctx context.Context, f *core.FuncInfo, args, result core.Object) (data interface{}, err error) {
+			rule := findRule(rules, ctx, f)
+			if rule == nil {
+				return nil, nil
+			}
+			return inject(rule, result)
+		},
+		Post: func(ctx context.Context, f *core.FuncInfo, args, result core.Object, data interface{}) error {
+			if rule, ok := data.(*Rule); ok && rule.Action == ActionCorrupt {
+				corrupt(result)
+			}
+			return nil
+		},
+	})
+}
+
+func (c *Rule) validate() error {
+	if c.Func == "" {
+		return fmt.Errorf("fault: rule requires func")
+	}
+	switch c.Action {
+	case ActionError, ActionPanic, ActionCorrupt:
+	case ActionDelay:
+		if c.Delay <= 0 {
+			return fmt.Errorf("fault: rule of %s: delay requires a positive delay", c.Func)
+		}
+	default:
+		return fmt.Errorf("fault: rule of %s: unknown action %q, expect one of: error, delay, panic, corrupt", c.Func, c.Action)
+	}
+	if c.Probability < 0 || c.Probability > 1 {
+		return fmt.Errorf("fault: rule of %s: probability must be within [0,1], actual: %v", c.Func, c.Probability)
+	}
+	return nil
+}
+
+func findRule(rules []*Rule, ctx context.Context, f *core.FuncInfo) *Rule {
+	for _, rule := range rules {
+		if !rule.match(ctx, f) {
+			continue
+		}
+		n := atomic.AddInt64(&rule.calls, 1)
+		if rule.Nth > 0 && n != rule.Nth {
+			continue
+		}
+		if rule.Probability > 0 && randFloat() >= rule.Probability {
+			continue
+		}
+		return rule
+	}
+	return nil
+}
+
+func (c *Rule) match(ctx context.Context, f *core.FuncInfo) bool {
+	if c.Action == ActionError && !f.LastResultErr {
+		return false
+	}
+	if c.CtxKey != nil && (!f.FirstArgCtx || ctx.Value(c.CtxKey) == nil) {
+		return false
+	}
+	return matchPattern(c.Func, f.Pkg+"."+f.IdentityName) || matchPattern(c.Func, f.IdentityName)
+}
+
+func (c *Rule) message() string {
+	if c.Message == "" {
+		return defaultMessage
+	}
+	return c.Message
+}
+
+func inject(rule *Rule, result core.Object) (interface{}, error) {
+	switch rule.Action {
+	case ActionError:
+		err := ErrInjected
+		if rule.Message != "" {
+			err = errors.New(rule.Message)
+		}
+		result.(core.ObjectWithErr).GetErr().Set(err)
+		return nil, trap.ErrAbort
+	case ActionDelay:
+		time.Sleep(time.Duration(rule.Delay))
+	case ActionPanic:
+		// trap still calls Post of interceptors wrapping
+		// this one, so traces of the call stay balanced
+		panic(errors.New(rule.message()))
+	case ActionCorrupt:
+		// after the call
+		return rule, nil
+	}
+	return nil, nil
+}
+
+func corrupt(result core.Object) {
+	n := result.NumField()
+	for i := 0; i < n; i++ {
+		result.GetFieldIndex(i).Set(nil)
+	}
+}
+
+// matchPattern matches s against pattern where '*'
+// matches any characters, including '/' and '.'
+func matchPattern(pattern string, s string) bool {
+	idx := strings.Index(pattern, "*")
+	if idx < 0 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, pattern[:idx]) {
+		return false
+	}
+	rest := pattern[idx+1:]
+	s = s[idx:]
+	for i := 0; i <= len(s); i++ {
+		if matchPattern(rest, s[i:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Config is the content of the file specified by XGO_FAULT_CONFIG,
+// which is set by 'xgo test --fault-config'
+type Config struct {
+	// Seed makes probabilities reproducible, random if 0
+	Seed  int64   `json:"seed,omitempty"`
+	Rules []*Rule `json:"rules"`
+}
+
+// Load adds rules of a config file
+func Load(file string) (func(), error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return nil, fmt.Errorf("fault: parse %s: %w", file, err)
+	}
+	for _, rule := range config.Rules {
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	if config.Seed != 0 {
+		SetSeed(config.Seed)
+	}
+	return Add(config.Rules...), nil
+}
+
+func init() {
+	file := os.Getenv("XGO_FAULT_CONFIG")
+	if file == "" {
+		return
+	}
+	_, err := Load(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "xgo fault: %v\n", err)
+	}
+}
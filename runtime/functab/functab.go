@@ -28,7 +28,7 @@ func init() {
 
 // rewrite at compile time by compiler, the body will be replaced with
 // a call to runtime.__xgo_for_each_func
-func __xgo_link_for_each_func(f func(pkgPath string, recvTypeName string, recvPtr bool, name string, identityName string, generic bool, pc uintptr, fn interface{}, recvName string, argNames []string, resNames []string, firstArgCtx bool, lastResErr bool)) {
+func __xgo_link_for_each_func(f func(pkgPath string, recvTypeName string, recvPtr bool, name string, identityName string, generic bool, pc uintptr, fn interface{}, recvName string, argNames []string, resNames []string, firstArgCtx bool, lastResErr bool, file string, line int, endLine int)) {
 	panic("failed to link __xgo_link_for_each_func")
 }
 
@@ -94,7 +94,7 @@ func ensureMapping() {
 	mappingOnce.Do(func() {
 		funcPCMapping = make(map[uintptr]*core.FuncInfo)
 		funcInfoMapping = make(map[string]map[string]*core.FuncInfo)
-		__xgo_link_for_each_func(func(pkgPath string, recvTypeName string, recvPtr bool, name string, identityName string, generic bool, pc uintptr, fn interface{}, recvName string, argNames []string, resNames []string, firstArgCtx bool, lastResErr bool) {
+		__xgo_link_for_each_func(func(pkgPath string, recvTypeName string, recvPtr bool, name string, identityName string, generic bool, pc uintptr, fn interface{}, recvName string, argNames []string, resNames []string, firstArgCtx bool, lastResErr bool, file string, line int, endLine int) {
 			if identityName == "" {
 				// 	fmt.Fprintf(os.Stderr, "empty name\n",pkgPath)
 				return
@@ -111,6 +111,10 @@ func ensureMapping() {
 				RecvPtr:      recvPtr,
 				Generic:      generic,
 
+				File:    file,
+				Line:    line,
+				EndLine: endLine,
+
 				// runtime info
 				PC:   pc, // nil for generic
 				Func: fn, // nil for geneirc
@@ -3,6 +3,7 @@ package mock
 import (
 	"context"
 	"errors"
+	"fmt"
 
 	"github.com/xhd2015/xgo/runtime/core"
 	"github.com/xhd2015/xgo/runtime/trap"
@@ -18,16 +19,17 @@ func GetInterceptors() []Interceptor {
 	return interceptors
 }
 
-// TODO: ensure them run in last?
-// no abort, run mocks
-// mocks are special in that they on run in pre stage
-func AddFuncInterceptor(fn interface{}, interceptor Interceptor) {
-	trap.AddInterceptor(&trap.Interceptor{
+// mocks run in PhaseMock: after all other Pre, so that
+// observers like trace see the call and its mocked results.
+//
+// The interceptor is indexed by fn, so other functions
+// are not slowed down no matter how many mocks are added.
+// Like trap.AddInterceptor, the returned func disposes
+// the mock if called after init.
+func AddFuncInterceptor(fn interface{}, interceptor Interceptor) func() {
+	return trap.AddFuncInterceptor(fn, &trap.Interceptor{
+		Phase: trap.PhaseMock,
 		Pre: func(ctx context.Context, f *core.FuncInfo, args, result core.Object) (data interface{}, err error) {
-			if !f.IsFunc(fn) {
-				// continue
-				return nil, nil
-			}
 			// TODO: add panic check
 			err = interceptor(ctx, f, args, result)
 			if err == ErrCallOld {
@@ -40,6 +42,24 @@ func AddFuncInterceptor(fn interface{}, interceptor Interceptor) {
 	})
 }
 
+// WithCtx lets the original fn run with the ctx returned by
+// derive, e.g. to inject a deadline or a value. fn's first argument
+// must be a context.Context. Unlike AddFuncInterceptor, fn is not
+// mocked, mocks of fn see the derived ctx too.
+func WithCtx(fn interface{}, derive func(ctx context.Context) context.Context) func() {
+	return trap.AddFuncInterceptor(fn, &trap.Interceptor{
+		Phase: trap.PhaseModify,
+		Pre: func(ctx context.Context, f *core.FuncInfo, args, result core.Object) (data interface{}, err error) {
+			withCtx, ok := args.(core.ObjectWithCtx)
+			if !ok {
+				return nil, fmt.Errorf("mock: first argument of %s is not context.Context", f.DisplayName())
+			}
+			withCtx.GetCtx().Set(derive(ctx))
+			return nil, nil
+		},
+	})
+}
+
 func CallOld() {
 	// TODO: implement recover
 	panic(ErrCallOld)
@@ -0,0 +1,334 @@
+package mockclock
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/xhd2015/xgo/runtime/core"
+	"github.com/xhd2015/xgo/runtime/trap"
+)
+
+const __XGO_SKIP_TRAP = true
+
+// Clock is a virtual clock, it only moves when
+// Advance is called or a goroutine using it sleeps
+type Clock struct {
+	mutex  sync.Mutex
+	now    time.Time
+	timers []*timer // pending, ordered by when, then creation
+	// by address of the *time.Timer or *time.Ticker, an entry
+	// is kept as long as it is reachable, because a fired or
+	// stopped timer can still be reset, see add
+	byRef map[uintptr]*timer
+}
+
+type timer struct {
+	when   time.Time
+	period time.Duration // tickers
+	c      chan time.Time
+	f      func() // AfterFunc
+}
+
+// New creates a clock starting at start, the
+// monotonic clock reading of start is stripped
+func New(start time.Time) *Clock {
+	return &Clock{
+		now:   start.Round(0),
+		byRef: make(map[uintptr]*timer),
+	}
+}
+
+// Start creates a clock starting at current time and
+// uses it for current goroutine, see Use.
+func Start() (*Clock, func()) {
+	c := New(time.Now())
+	return c, c.Use()
+}
+
+// Now returns current virtual time
+func (c *Clock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d, timers and
+// tickers due within d fire in order, each seeing
+// its own firing time as now.
+// Advance can be called from any goroutine.
+func (c *Clock) Advance(d time.Duration) {
+	if d < 0 {
+		panic(errors.New("mockclock: advance by negative duration"))
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	target := c.now.Add(d)
+	for len(c.timers) > 0 && !c.timers[0].when.After(target) {
+		t := c.timers[0]
+		c.timers = c.timers[1:]
+		c.now = t.when
+		c.fire(t)
+		if t.period > 0 {
+			t.when = t.when.Add(t.period)
+			c.schedule(t)
+		}
+	}
+	c.now = target
+}
+
+// like the runtime, sending to c never blocks
+func (c *Clock) fire(t *timer) {
+	if t.f != nil {
+		go t.f()
+		return
+	}
+	select {
+	case t.c <- c.now:
+	default:
+	}
+}
+
+func (c *Clock) schedule(t *timer) {
+	i := sort.Search(len(c.timers), func(i int) bool {
+		return c.timers[i].when.After(t.when)
+	})
+	c.timers = append(c.timers, nil)
+	copy(c.timers[i+1:], c.timers[i:])
+	c.timers[i] = t
+}
+
+// unschedule reports whether t was pending
+func (c *Clock) unschedule(t *timer) bool {
+	for i, x := range c.timers {
+		if x == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// add creates a timer for ref, a *time.Timer or *time.Ticker.
+// Its entry is deleted once ref is garbage collected, so
+// timers dropped by code like time.After in a loop do not
+// pile up. A func of AfterFunc referring to its own timer
+// keeps the entry until the clock is collected.
+func (c *Clock) add(ref interface{}, d time.Duration, period time.Duration, ch chan time.Time, f func()) {
+	key := refKey(ref)
+	c.mutex.Lock()
+	t := &timer{when: c.now.Add(d), period: period, c: ch, f: f}
+	c.byRef[key] = t
+	c.schedule(t)
+	c.mutex.Unlock()
+	runtime.SetFinalizer(ref, func(interface{}) {
+		c.mutex.Lock()
+		delete(c.byRef, key)
+		c.mutex.Unlock()
+	})
+}
+
+func refKey(ref interface{}) uintptr {
+	return reflect.ValueOf(ref).Pointer()
+}
+
+func (c *Clock) stop(ref interface{}) (active bool, ok bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	t := c.byRef[refKey(ref)]
+	if t == nil {
+		return false, false
+	}
+	return c.unschedule(t), true
+}
+
+func (c *Clock) reset(ref interface{}, d time.Duration, period time.Duration) (active bool, ok bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	t := c.byRef[refKey(ref)]
+	if t == nil {
+		return false, false
+	}
+	active = c.unschedule(t)
+	t.when = c.now.Add(d)
+	if t.period > 0 {
+		t.period = period
+	}
+	c.schedule(t)
+	return active, true
+}
+
+// a real timer that never fires, so that Stop and
+// Reset called where the clock is not used still work.
+// It is made by AfterFunc, since go1.23 never finalizes
+// a timer with a channel, see add
+func newIdleTimer(ch chan time.Time) *time.Timer {
+	t := time.AfterFunc(math.MaxInt64, func() {})
+	t.Stop()
+	t.C = ch
+	return t
+}
+
+// time.Ticker has the same layout as time.Timer in
+// all go versions, there is no AfterFunc for tickers
+func newIdleTicker(ch chan time.Time) *time.Ticker {
+	return (*time.Ticker)(unsafe.Pointer(newIdleTimer(ch)))
+}
+
+// Use makes time.Now, time.Since, time.Until, time.Sleep,
+// time.After, time.AfterFunc, time.Tick, time.NewTimer,
+// time.NewTicker and methods of the returned timers and
+// tickers driven by c. time.Sleep advances c instead of
+// blocking.
+//
+// Like trap.AddFuncInterceptor, it applies to all
+// goroutines if called from init, otherwise only to
+// current goroutine, goroutines started by it still use
+// the real clock. The returned func restores the real clock.
+// A clock bound to a context.Context is not supported,
+// since time.Now has no ctx to check.
+//
+// time funcs of std lib are only trapped when built with
+// xgo --mock-clock, Use panics otherwise.
+func (c *Clock) Use() func() {
+	if !timeTrapped() {
+		panic(errors.New("mockclock: time functions are not trapped, run with xgo --mock-clock"))
+	}
+	// a single interceptor for all funcs, so the real
+	// ones are called when it calls into package time
+	interceptor := &trap.Interceptor{
+		Phase: trap.PhaseMock,
+		Pre: func(ctx context.Context, f *core.FuncInfo, args, result core.Object) (data interface{}, err error) {
+			if !c.handle(f.IdentityName, args, result) {
+				return nil, nil
+			}
+			return nil, trap.ErrAbort
+		},
+	}
+	fns := []interface{}{
+		time.Now, time.Since, time.Until, time.Sleep,
+		time.After, time.AfterFunc, time.Tick,
+		time.NewTimer, time.NewTicker,
+		(*time.Timer).Stop, (*time.Timer).Reset,
+		(*time.Ticker).Stop, (*time.Ticker).Reset,
+	}
+	disposers := make([]func(), 0, len(fns))
+	for _, fn := range fns {
+		disposers = append(disposers, trap.AddFuncInterceptor(fn, interceptor))
+	}
+	return func() {
+		for _, dispose := range disposers {
+			dispose()
+		}
+	}
+}
+
+var trappedOnce sync.Once
+var trapped bool
+
+// timeTrapped reports whether an interceptor of time.Now is called
+func timeTrapped() bool {
+	trappedOnce.Do(func() {
+		var hit int32
+		dispose := trap.AddFuncInterceptor(time.Now, &trap.Interceptor{
+			Pre: func(ctx context.Context, f *core.FuncInfo, args, result core.Object) (data interface{}, err error) {
+				atomic.StoreInt32(&hit, 1)
+				return nil, nil
+			},
+		})
+		time.Now()
+		dispose()
+		trapped = atomic.LoadInt32(&hit) != 0
+	})
+	return trapped
+}
+
+// handle reports false to let the real func run,
+// i.e. the timer or ticker is not created by c
+func (c *Clock) handle(name string, args, result core.Object) bool {
+	arg := func(i int) interface{} {
+		return args.GetFieldIndex(i).Value()
+	}
+	setResult := func(v interface{}) {
+		result.GetFieldIndex(0).Set(v)
+	}
+	switch name {
+	case "Now":
+		setResult(c.Now())
+	case "Since":
+		setResult(c.Now().Sub(arg(0).(time.Time)))
+	case "Until":
+		setResult(arg(0).(time.Time).Sub(c.Now()))
+	case "Sleep":
+		if d := arg(0).(time.Duration); d > 0 {
+			c.Advance(d)
+		}
+	case "After":
+		setResult((<-chan time.Time)(c.newTimer(arg(0).(time.Duration)).C))
+	case "AfterFunc":
+		t := newIdleTimer(nil)
+		c.add(t, arg(0).(time.Duration), 0, nil, arg(1).(func()))
+		setResult(t)
+	case "NewTimer":
+		setResult(c.newTimer(arg(0).(time.Duration)))
+	case "Tick":
+		d := arg(0).(time.Duration)
+		if d <= 0 {
+			setResult((<-chan time.Time)(nil))
+			return true
+		}
+		setResult((<-chan time.Time)(c.newTicker(d).C))
+	case "NewTicker":
+		d := arg(0).(time.Duration)
+		if d <= 0 {
+			panic(errors.New("non-positive interval for NewTicker"))
+		}
+		setResult(c.newTicker(d))
+	case "(*Timer).Stop":
+		active, ok := c.stop(arg(0))
+		if !ok {
+			return false
+		}
+		setResult(active)
+	case "(*Timer).Reset":
+		active, ok := c.reset(arg(0), arg(1).(time.Duration), 0)
+		if !ok {
+			return false
+		}
+		setResult(active)
+	case "(*Ticker).Stop":
+		_, ok := c.stop(arg(0))
+		return ok
+	case "(*Ticker).Reset":
+		d := arg(1).(time.Duration)
+		if d <= 0 {
+			panic(errors.New("non-positive interval for Ticker.Reset"))
+		}
+		_, ok := c.reset(arg(0), d, d)
+		return ok
+	default:
+		return false
+	}
+	return true
+}
+
+func (c *Clock) newTimer(d time.Duration) *time.Timer {
+	ch := make(chan time.Time, 1)
+	t := newIdleTimer(ch)
+	c.add(t, d, 0, ch, nil)
+	return t
+}
+
+func (c *Clock) newTicker(d time.Duration) *time.Ticker {
+	ch := make(chan time.Time, 1)
+	t := newIdleTicker(ch)
+	c.add(t, d, d, ch, nil)
+	return t
+}
@@ -0,0 +1,47 @@
+package mockclock
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+// go test -run TestDroppedTimersAreForgotten -v ./mockclock
+func TestDroppedTimersAreForgotten(t *testing.T) {
+	c := New(time.Unix(0, 0))
+	for i := 0; i < 100; i++ {
+		// like time.After in a loop
+		c.newTimer(time.Second)
+		c.Advance(time.Second)
+		// like time.Tick in a loop
+		c.newTicker(time.Second)
+	}
+	kept := c.newTimer(time.Second)
+	c.Advance(time.Second)
+	<-kept.C
+
+	numRefs := func() int {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		return len(c.byRef)
+	}
+	// finalizers run in another goroutine after GC
+	for i := 0; i < 50 && numRefs() > 1; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := numRefs(); n != 1 {
+		t.Fatalf("expect only the reachable timer kept, actual: %d", n)
+	}
+
+	// a fired timer can still be reset
+	if _, ok := c.reset(kept, time.Second, 0); !ok {
+		t.Fatalf("expect fired timer known to the clock")
+	}
+	c.Advance(time.Second)
+	select {
+	case <-kept.C:
+	default:
+		t.Fatalf("expect reset timer fired")
+	}
+}
@@ -0,0 +1,113 @@
+package record
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+func argsEqual(a []byte, b []byte) bool {
+	return bytes.Equal(compactJSON(a), compactJSON(b))
+}
+
+func compactJSON(data []byte) []byte {
+	var buf bytes.Buffer
+	err := json.Compact(&buf, data)
+	if err != nil {
+		return data
+	}
+	return buf.Bytes()
+}
+
+func indentJSON(data []byte) string {
+	var buf bytes.Buffer
+	err := json.Indent(&buf, data, "", "    ")
+	if err != nil {
+		return string(data)
+	}
+	return buf.String()
+}
+
+// values whose LCS table would exceed this many
+// cells are aligned greedily
+var maxLCSCells = 4 * 1024 * 1024
+
+// diffJSON shows a line diff between expected and
+// actual JSON, lines prefixed with "-" are only in
+// expected, and "+" only in actual
+func diffJSON(expected []byte, actual []byte) string {
+	a := strings.Split(indentJSON(expected), "\n")
+	b := strings.Split(indentJSON(actual), "\n")
+	if len(a)*len(b) > maxLCSCells {
+		return diffLinesGreedy(a, b)
+	}
+
+	// lcs[i][j]: length of longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var out strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			out.WriteString("  " + a[i] + "\n")
+			i++
+			j++
+		case j >= len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			out.WriteString("- " + a[i] + "\n")
+			i++
+		default:
+			out.WriteString("+ " + b[j] + "\n")
+			j++
+		}
+	}
+	return out.String()
+}
+
+// diffLinesGreedy pairs each expected line with the next
+// actual line equal to it, actual lines skipped over are
+// added. It takes linear memory, but may report more
+// differences than the LCS of diffJSON.
+func diffLinesGreedy(a []string, b []string) string {
+	// positions of each line in b, in order
+	positions := make(map[string][]int)
+	for j, line := range b {
+		positions[line] = append(positions[line], j)
+	}
+	var out strings.Builder
+	j := 0
+	for _, line := range a {
+		pos := positions[line]
+		for len(pos) > 0 && pos[0] < j {
+			pos = pos[1:]
+		}
+		positions[line] = pos
+		if len(pos) == 0 {
+			out.WriteString("- " + line + "\n")
+			continue
+		}
+		for ; j < pos[0]; j++ {
+			out.WriteString("+ " + b[j] + "\n")
+		}
+		out.WriteString("  " + line + "\n")
+		j++
+	}
+	for ; j < len(b); j++ {
+		out.WriteString("+ " + b[j] + "\n")
+	}
+	return out.String()
+}
@@ -0,0 +1,352 @@
+package record
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xhd2015/xgo/runtime/core"
+	"github.com/xhd2015/xgo/runtime/trace"
+	"github.com/xhd2015/xgo/runtime/trap"
+)
+
+const __XGO_SKIP_TRAP = true
+
+const (
+	ModeOff    = ""
+	ModeRecord = "record"
+	ModeReplay = "replay"
+)
+
+// recordings are stored as <Dir>/<test name>.json,
+// relative to the package directory of the test
+const Dir = "testdata/xgo_record"
+
+var ErrNoRecording = errors.New("record: no matching recording")
+
+// Recording is the content of a golden file
+type Recording struct {
+	// salt of hashes replacing sensitive args,
+	// empty for recordings with args as is
+	Salt  string  `json:"salt,omitempty"`
+	Calls []*Call `json:"calls"`
+}
+
+type Call struct {
+	Func    string          `json:"func"`
+	Args    json.RawMessage `json:"args"`
+	Results json.RawMessage `json:"results,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// Funcs records or replays calls to fns made by the test
+// goroutine, depending on XGO_RECORD_MODE:
+//   - record: calls go through, args and results are saved
+//     to testdata/xgo_record/<test name>.json when the test ends,
+//   - replay: calls are mocked with results from the recording
+//     with equal args, a mismatch fails the test with a diff,
+//   - empty: calls go through.
+//
+// fns are functions or method expressions like (*Client).Get
+func Funcs(t testing.TB, fns ...interface{}) {
+	t.Helper()
+	Match(t, func(f *core.FuncInfo) bool {
+		for _, fn := range fns {
+			if f.IsFunc(fn) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Match is like Funcs, but selects functions by match,
+// e.g. all methods of a service:
+//
+//	record.Match(t, func(f *core.FuncInfo) bool {
+//	    return f.RecvType == "*UserService" && f.FirstArgCtx
+//	})
+func Match(t testing.TB, match func(f *core.FuncInfo) bool) {
+	t.Helper()
+	mode := getMode()
+	file := filepath.Join(Dir, fileName(t.Name())+".json")
+	switch mode {
+	case ModeOff:
+		return
+	case ModeRecord:
+		startRecord(t, file, match)
+	case ModeReplay:
+		startReplay(t, file, match)
+	default:
+		t.Fatalf("record: unknown XGO_RECORD_MODE %q, expect %s or %s", mode, ModeRecord, ModeReplay)
+	}
+}
+
+func getMode() string {
+	return os.Getenv("XGO_RECORD_MODE")
+}
+
+func startRecord(t testing.TB, file string, match func(f *core.FuncInfo) bool) {
+	salt, err := newSalt()
+	if err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	recording := &Recording{Salt: salt}
+	dispose := trap.AddInterceptor(&trap.Interceptor{
+		Phase: trap.PhaseObserve,
+		Pre: func(ctx context.Context, f *core.FuncInfo, args, result core.Object) (data interface{}, err error) {
+			trap.Skip()
+			if !match(f) {
+				return nil, nil
+			}
+			// serialize args before the call mutates them.
+			// args are only compared, so sensitive ones are
+			// hashed, results must be decoded back, so nothing
+			// is truncated or redacted
+			return &Call{
+				Func: funcKey(f),
+				Args: trace.MarshalObjectSalted(args, salt),
+			}, nil
+		},
+		Post: func(ctx context.Context, f *core.FuncInfo, args, result core.Object, data interface{}) error {
+			trap.Skip()
+			call, ok := data.(*Call)
+			if !ok {
+				return nil
+			}
+			call.Results = trace.MarshalObjectLossless(result)
+			call.Error = getErrMsg(result)
+			recording.Calls = append(recording.Calls, call)
+			return nil
+		},
+	})
+	t.Cleanup(func() {
+		dispose()
+		err := writeRecording(file, recording)
+		if err != nil {
+			t.Errorf("record: %v", err)
+		}
+	})
+}
+
+func startReplay(t testing.TB, file string, match func(f *core.FuncInfo) bool) {
+	recording, err := readRecording(file)
+	if err != nil {
+		t.Fatalf("record: %v, run with XGO_RECORD_MODE=record to create it", err)
+	}
+	used := make([]bool, len(recording.Calls))
+	dispose := trap.AddInterceptor(&trap.Interceptor{
+		Phase: trap.PhaseMock,
+		Pre: func(ctx context.Context, f *core.FuncInfo, args, result core.Object) (data interface{}, err error) {
+			trap.Skip()
+			if !match(f) {
+				return nil, nil
+			}
+			key := funcKey(f)
+			actualArgs := marshalArgs(recording, args)
+			idx := -1
+			var candidate *Call
+			for i, call := range recording.Calls {
+				if used[i] || call.Func != key {
+					continue
+				}
+				if candidate == nil {
+					candidate = call
+				}
+				if argsEqual(call.Args, actualArgs) {
+					idx = i
+					break
+				}
+			}
+			if idx < 0 {
+				if candidate == nil {
+					t.Errorf("record: unexpected call to %s, no more recordings in %s", key, file)
+				} else {
+					t.Errorf("record: args of %s do not match recording in %s:\n%s", key, file, diffJSON(showArgs(recording, candidate.Args), showArgs(recording, actualArgs)))
+				}
+				setErr(result, ErrNoRecording)
+				return nil, trap.ErrAbort
+			}
+			used[idx] = true
+			err = setResults(result, recording.Calls[idx])
+			if err != nil {
+				t.Errorf("record: replay %s: %v", key, err)
+				setErr(result, err)
+			}
+			return nil, trap.ErrAbort
+		},
+	})
+	t.Cleanup(func() {
+		dispose()
+		for i, call := range recording.Calls {
+			if !used[i] {
+				t.Errorf("record: recorded call to %s not replayed, args: %s", call.Func, showArgs(recording, call.Args))
+			}
+		}
+	})
+}
+
+// marshalArgs serializes args the same way they are recorded
+func marshalArgs(recording *Recording, args core.Object) []byte {
+	if recording.Salt == "" {
+		return trace.MarshalObjectLossless(args)
+	}
+	return trace.MarshalObjectSalted(args, recording.Salt)
+}
+
+// showArgs returns args to be shown in errors, args of
+// recordings without salt are redacted here
+func showArgs(recording *Recording, args []byte) []byte {
+	if recording.Salt == "" {
+		return trace.RedactJSON(args)
+	}
+	return compactJSON(args)
+}
+
+func newSalt() (string, error) {
+	var b [8]byte
+	_, err := rand.Read(b[:])
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+func funcKey(f *core.FuncInfo) string {
+	return f.Pkg + "." + f.IdentityName
+}
+
+func getErrMsg(result core.Object) string {
+	errObj, ok := result.(core.ObjectWithErr)
+	if !ok {
+		return ""
+	}
+	fnErr := errObj.GetErr().Value()
+	if fnErr == nil {
+		return ""
+	}
+	return fnErr.(error).Error()
+}
+
+func setErr(result core.Object, err error) {
+	errObj, ok := result.(core.ObjectWithErr)
+	if !ok {
+		return
+	}
+	errObj.GetErr().Set(err)
+}
+
+func setResults(result core.Object, call *Call) error {
+	values, err := decodeFields(call.Results)
+	if err != nil {
+		return err
+	}
+	n := result.NumField()
+	if len(values) != n {
+		return fmt.Errorf("expect %d results, recorded %d", n, len(values))
+	}
+	for i := 0; i < n; i++ {
+		field := result.GetFieldIndex(i)
+		data := values[i]
+		if string(data) == "null" {
+			continue
+		}
+		t := reflect.TypeOf(field.Value())
+		if t == nil {
+			return fmt.Errorf("result %s: cannot replay nil interface value", field.Name())
+		}
+		ptr := reflect.New(t)
+		err := json.Unmarshal(data, ptr.Interface())
+		if err != nil {
+			return fmt.Errorf("result %s: %w", field.Name(), err)
+		}
+		field.Set(ptr.Elem().Interface())
+	}
+	if call.Error != "" {
+		setErr(result, errors.New(call.Error))
+	}
+	return nil
+}
+
+// decodeFields decodes values of a serialized core.Object in order,
+// because names of unnamed results are all empty
+func decodeFields(data []byte) ([]json.RawMessage, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if tok != json.Delim('{') {
+		return nil, fmt.Errorf("expect object, found: %v", tok)
+	}
+	var values []json.RawMessage
+	for dec.More() {
+		// key
+		_, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var value json.RawMessage
+		err = dec.Decode(&value)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func readRecording(file string) (*Recording, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var recording Recording
+	err = json.Unmarshal(data, &recording)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", file, err)
+	}
+	return &recording, nil
+}
+
+func writeRecording(file string, recording *Recording) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	// keep placeholders like "<func>" readable
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "    ")
+	err := enc.Encode(recording)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, buf.Bytes(), 0755)
+}
+
+// subtests are stored in sub directories
+func fileName(testName string) string {
+	var b strings.Builder
+	for _, r := range testName {
+		if r == '/' || r == '-' || r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
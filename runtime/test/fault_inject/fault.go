@@ -0,0 +1,23 @@
+package fault_inject
+
+import (
+	"context"
+	"errors"
+)
+
+type Client struct{}
+
+func (c *Client) Get(ctx context.Context, key string) (string, error) {
+	return "value of " + key, nil
+}
+
+func count(s string) int {
+	return len(s)
+}
+
+func save(data string) error {
+	if data == "" {
+		return errors.New("empty data")
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package fault_inject
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xhd2015/xgo/runtime/fault"
+	"github.com/xhd2015/xgo/runtime/trace"
+)
+
+// xgo test -v ./test/fault_inject
+
+const pkg = "github.com/xhd2015/xgo/runtime/test/fault_inject"
+
+func TestError(t *testing.T) {
+	defer fault.Add(&fault.Rule{
+		Func:    pkg + ".(*Client).*",
+		Action:  fault.ActionError,
+		Message: "connection reset",
+	})()
+
+	c := &Client{}
+	val, err := c.Get(context.Background(), "a")
+	if err == nil || err.Error() != "connection reset" {
+		t.Fatalf("expect injected error %q, actual: %v", "connection reset", err)
+	}
+	if val != "" {
+		t.Fatalf("expect no result, actual: %q", val)
+	}
+}
+
+func TestErrorOnlyForErrorFuncs(t *testing.T) {
+	defer fault.Add(&fault.Rule{
+		Func:   "*",
+		Action: fault.ActionError,
+	})()
+
+	if n := count("abc"); n != 3 {
+		t.Fatalf("expect func without error result unaffected, actual: %d", n)
+	}
+	if err := save("abc"); err != fault.ErrInjected {
+		t.Fatalf("expect %v, actual: %v", fault.ErrInjected, err)
+	}
+}
+
+func TestNth(t *testing.T) {
+	defer fault.Add(&fault.Rule{
+		Func:   "save",
+		Nth:    2,
+		Action: fault.ActionError,
+	})()
+
+	var errs []error
+	for i := 0; i < 3; i++ {
+		errs = append(errs, save("abc"))
+	}
+	if errs[0] != nil || errs[1] != fault.ErrInjected || errs[2] != nil {
+		t.Fatalf("expect only the 2nd call fails, actual: %v", errs)
+	}
+}
+
+func TestProbability(t *testing.T) {
+	fault.SetSeed(1)
+	defer fault.Add(&fault.Rule{
+		Func:        "save",
+		Probability: 0.5,
+		Action:      fault.ActionError,
+	})()
+
+	var failed int
+	for i := 0; i < 1000; i++ {
+		if save("abc") != nil {
+			failed++
+		}
+	}
+	if failed < 400 || failed > 600 {
+		t.Fatalf("expect about half calls fail, actual: %d", failed)
+	}
+}
+
+type chaosKey struct{}
+
+func TestCtxKey(t *testing.T) {
+	defer fault.Add(&fault.Rule{
+		Func:   "(*Client).Get",
+		CtxKey: chaosKey{},
+		Action: fault.ActionError,
+	})()
+
+	c := &Client{}
+	if _, err := c.Get(context.Background(), "a"); err != nil {
+		t.Fatalf("expect no fault without ctx key, actual: %v", err)
+	}
+	ctx := context.WithValue(context.Background(), chaosKey{}, true)
+	if _, err := c.Get(ctx, "a"); err != fault.ErrInjected {
+		t.Fatalf("expect fault with ctx key, actual: %v", err)
+	}
+}
+
+func TestPanic(t *testing.T) {
+	defer fault.Add(&fault.Rule{
+		Func:    "count",
+		Action:  fault.ActionPanic,
+		Message: "boom",
+	})()
+
+	defer func() {
+		e := recover()
+		err, ok := e.(error)
+		if !ok || err.Error() != "boom" {
+			t.Fatalf("expect panic %q, actual: %v", "boom", e)
+		}
+	}()
+	count("abc")
+	t.Fatalf("expect panic")
+}
+
+func TestPanicKeepsTraceBalanced(t *testing.T) {
+	t.Setenv("XGO_TRACE_OUTPUT", "stdout")
+	var roots []string
+	trace.SetMarshalStack(func(root *trace.Root) ([]byte, error) {
+		roots = append(roots, root.Top.FuncInfo.IdentityName)
+		return []byte("{}"), nil
+	})
+	defer trace.SetMarshalStack(nil)
+	defer fault.Add(&fault.Rule{
+		Func:   "count",
+		Action: fault.ActionPanic,
+	})()
+	trace.Enable()
+	defer trace.Disable()
+
+	recoverCount("abc")
+	// not nested under the panicked call
+	save("abc")
+
+	expect := "recoverCount,save"
+	actual := strings.Join(roots, ",")
+	if actual != expect {
+		t.Fatalf("expect traces %q, actual: %q", expect, actual)
+	}
+}
+
+func recoverCount(s string) (n int) {
+	defer func() {
+		recover()
+	}()
+	return count(s)
+}
+
+func TestCorrupt(t *testing.T) {
+	defer fault.Add(&fault.Rule{
+		Func:   "(*Client).Get",
+		Action: fault.ActionCorrupt,
+	})()
+
+	c := &Client{}
+	val, err := c.Get(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != "" {
+		t.Fatalf("expect corrupted result to be zero, actual: %q", val)
+	}
+}
+
+func TestDelay(t *testing.T) {
+	defer fault.Add(&fault.Rule{
+		Func:   "count",
+		Action: fault.ActionDelay,
+		Delay:  fault.Duration(50 * time.Millisecond),
+	})()
+
+	begin := time.Now()
+	count("abc")
+	if cost := time.Since(begin); cost < 50*time.Millisecond {
+		t.Fatalf("expect delay at least 50ms, actual: %v", cost)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "fault.json")
+	err := os.WriteFile(file, []byte(`{"seed": 1, "rules": [{"func": "save", "action": "error", "message": "disk full"}]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dispose, err := fault.Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dispose()
+
+	err = save("abc")
+	if err == nil || err.Error() != "disk full" {
+		t.Fatalf("expect %q, actual: %v", "disk full", err)
+	}
+}
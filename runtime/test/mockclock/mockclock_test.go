@@ -0,0 +1,178 @@
+package mockclock
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/xhd2015/xgo/runtime/mockclock"
+)
+
+// xgo test --mock-clock -v ./test/mockclock
+
+var start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestNowAndAdvance(t *testing.T) {
+	c := mockclock.New(start)
+	defer c.Use()()
+
+	if now := time.Now(); !now.Equal(start) {
+		t.Fatalf("expect now: %v, actual: %v", start, now)
+	}
+	c.Advance(time.Hour)
+	if now := time.Now(); !now.Equal(start.Add(time.Hour)) {
+		t.Fatalf("expect now: %v, actual: %v", start.Add(time.Hour), now)
+	}
+	if d := time.Since(start); d != time.Hour {
+		t.Fatalf("expect since: %v, actual: %v", time.Hour, d)
+	}
+	if d := time.Until(start.Add(2 * time.Hour)); d != time.Hour {
+		t.Fatalf("expect until: %v, actual: %v", time.Hour, d)
+	}
+}
+
+func TestSleepAdvances(t *testing.T) {
+	c := mockclock.New(start)
+	defer c.Use()()
+
+	calls := 0
+	elapsed, err := retry(4, func() error {
+		calls++
+		if calls < 4 {
+			return errors.New("not ready")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 1s + 2s + 4s
+	if elapsed != 7*time.Second {
+		t.Fatalf("expect elapsed: %v, actual: %v", 7*time.Second, elapsed)
+	}
+	if now := c.Now(); !now.Equal(start.Add(7 * time.Second)) {
+		t.Fatalf("expect clock: %v, actual: %v", start.Add(7*time.Second), now)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	c := mockclock.New(start)
+	defer c.Use()()
+
+	// the clock is moved by another goroutine
+	// while this one waits
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				c.Advance(time.Second)
+				runtime.Gosched()
+			}
+		}
+	}()
+	err := waitOrTimeout(make(chan struct{}), time.Minute)
+	if err != errTimeout {
+		t.Fatalf("expect %v, actual: %v", errTimeout, err)
+	}
+	if c.Now().Before(start.Add(time.Minute)) {
+		t.Fatalf("expect timeout after a minute, actual: %v", c.Now().Sub(start))
+	}
+}
+
+func TestAfterFiresOnAdvance(t *testing.T) {
+	c := mockclock.New(start)
+	defer c.Use()()
+
+	ch := time.After(time.Minute)
+	c.Advance(59 * time.Second)
+	select {
+	case <-ch:
+		t.Fatalf("expect not fired before a minute")
+	default:
+	}
+	c.Advance(time.Second)
+	select {
+	case at := <-ch:
+		if !at.Equal(start.Add(time.Minute)) {
+			t.Fatalf("expect fired at: %v, actual: %v", start.Add(time.Minute), at)
+		}
+	default:
+		t.Fatalf("expect fired after a minute")
+	}
+}
+
+func TestTimerStopAndReset(t *testing.T) {
+	c := mockclock.New(start)
+	defer c.Use()()
+
+	timer := time.NewTimer(time.Second)
+	if !timer.Stop() {
+		t.Fatalf("expect stop active timer")
+	}
+	c.Advance(time.Second)
+	select {
+	case <-timer.C:
+		t.Fatalf("expect stopped timer not fired")
+	default:
+	}
+	if timer.Reset(time.Second) {
+		t.Fatalf("expect reset inactive timer returns false")
+	}
+	c.Advance(time.Second)
+	select {
+	case <-timer.C:
+	default:
+		t.Fatalf("expect reset timer fired")
+	}
+}
+
+func TestTickerAndAfterFunc(t *testing.T) {
+	c := mockclock.New(start)
+	defer c.Use()()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	fired := make(chan struct{})
+	time.AfterFunc(1500*time.Millisecond, func() {
+		close(fired)
+	})
+
+	c.Advance(time.Second)
+	if at := <-ticker.C; !at.Equal(start.Add(time.Second)) {
+		t.Fatalf("expect tick at: %v, actual: %v", start.Add(time.Second), at)
+	}
+	c.Advance(time.Second)
+	if at := <-ticker.C; !at.Equal(start.Add(2 * time.Second)) {
+		t.Fatalf("expect tick at: %v, actual: %v", start.Add(2*time.Second), at)
+	}
+	// would block forever if not fired
+	<-fired
+}
+
+func TestRestore(t *testing.T) {
+	c := mockclock.New(start)
+	restore := c.Use()
+	restore()
+
+	if now := time.Now(); now.Equal(start) {
+		t.Fatalf("expect real clock after restore")
+	}
+}
+
+func TestOnlyCurrentGoroutine(t *testing.T) {
+	c := mockclock.New(start)
+	defer c.Use()()
+
+	ch := make(chan time.Time)
+	go func() {
+		ch <- time.Now()
+	}()
+	if now := <-ch; now.Equal(start) {
+		t.Fatalf("expect other goroutines use the real clock")
+	}
+}
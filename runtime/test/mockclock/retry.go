@@ -0,0 +1,34 @@
+package mockclock
+
+import (
+	"errors"
+	"time"
+)
+
+// retry calls f until it succeeds, waiting longer each time
+func retry(n int, f func() error) (time.Duration, error) {
+	begin := time.Now()
+	wait := time.Second
+	var err error
+	for i := 0; i < n; i++ {
+		err = f()
+		if err == nil {
+			break
+		}
+		time.Sleep(wait)
+		wait *= 2
+	}
+	return time.Since(begin), err
+}
+
+var errTimeout = errors.New("timeout")
+
+// waitOrTimeout waits for done, or times out after d
+func waitOrTimeout(done <-chan struct{}, d time.Duration) error {
+	select {
+	case <-done:
+		return nil
+	case <-time.After(d):
+		return errTimeout
+	}
+}
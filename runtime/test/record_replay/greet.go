@@ -0,0 +1,29 @@
+package record_replay
+
+import (
+	"context"
+	"fmt"
+)
+
+type User struct {
+	ID   int
+	Name string
+}
+
+// GetUser stands for an RPC or DB call
+func GetUser(ctx context.Context, id int) (user *User, err error) {
+	return nil, fmt.Errorf("user service not available in tests")
+}
+
+func Greet(ctx context.Context, id int) (string, error) {
+	user, err := GetUser(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("hello %s", user.Name), nil
+}
+
+// Login stands for an RPC call taking sensitive args
+func Login(ctx context.Context, name string, password string) (token string, err error) {
+	return "token-" + name, nil
+}
@@ -0,0 +1,23 @@
+package record_replay
+
+import (
+	"context"
+	"testing"
+
+	"github.com/xhd2015/xgo/runtime/record"
+)
+
+// xgo test ./test/record_replay
+func TestGreet(t *testing.T) {
+	// GetUser is replayed from testdata/xgo_record/TestGreet.json
+	t.Setenv("XGO_RECORD_MODE", record.ModeReplay)
+	record.Funcs(t, GetUser)
+
+	greeting, err := Greet(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if greeting != "hello alice" {
+		t.Fatalf("expect greeting: %q, actual: %q", "hello alice", greeting)
+	}
+}
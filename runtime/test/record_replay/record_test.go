@@ -0,0 +1,187 @@
+package record_replay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xhd2015/xgo/runtime/record"
+)
+
+const loginFunc = "github.com/xhd2015/xgo/runtime/test/record_replay.Login"
+
+// fakeT collects errors and cleanups, so that failures
+// reported by record can be checked
+type fakeT struct {
+	testing.TB
+	name     string
+	errors   []string
+	cleanups []func()
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Name() string {
+	return t.name
+}
+
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func (t *fakeT) Fatalf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func (t *fakeT) Cleanup(f func()) {
+	t.cleanups = append(t.cleanups, f)
+}
+
+// end runs cleanups like the end of a test
+func (t *fakeT) end() {
+	for i := len(t.cleanups) - 1; i >= 0; i-- {
+		t.cleanups[i]()
+	}
+}
+
+// xgo test -run TestRecordWritesGolden -v ./test/record_replay
+func TestRecordWritesGolden(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	t.Setenv("XGO_RECORD_MODE", record.ModeRecord)
+
+	ft := &fakeT{TB: t, name: "TestLogin"}
+	record.Funcs(ft, Login)
+	// longer than the default MaxStringLen of trace
+	name := strings.Repeat("a", 5000)
+	token, err := Login(context.Background(), name, "hunter2")
+	ft.end()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ft.errors) > 0 {
+		t.Fatalf("expect no errors, actual: %v", ft.errors)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, record.Dir, "TestLogin.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var recording record.Recording
+	err = json.Unmarshal(data, &recording)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recording.Calls) != 1 || recording.Calls[0].Func != loginFunc {
+		t.Fatalf("expect 1 call to %s, actual: %s", loginFunc, data)
+	}
+	// not truncated, password replaced with a salted hash
+	var args struct {
+		Name     string `json:"name"`
+		Password string `json:"password"`
+	}
+	err = json.Unmarshal(recording.Calls[0].Args, &args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args.Name != name || !strings.HasPrefix(args.Password, "<redacted sha256:") {
+		t.Fatalf("expect name recorded as is and password hashed, actual: %s", recording.Calls[0].Args)
+	}
+	if recording.Salt == "" || strings.Contains(string(data), "hunter2") {
+		t.Fatalf("expect password not recorded, actual: %s", data)
+	}
+	var results struct {
+		Token string `json:"token"`
+	}
+	err = json.Unmarshal(recording.Calls[0].Results, &results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results.Token != token {
+		t.Fatalf("expect token: %q, actual: %s", token, recording.Calls[0].Results)
+	}
+}
+
+// xgo test -run TestReplayArgsMismatch -v ./test/record_replay
+func TestReplayArgsMismatch(t *testing.T) {
+	t.Setenv("XGO_RECORD_MODE", record.ModeReplay)
+
+	// recorded with name bob
+	ft := &fakeT{TB: t, name: "TestLoginMismatch"}
+	record.Funcs(ft, Login)
+	_, err := Login(context.Background(), "alice", "hunter2")
+	ft.end()
+	if err != record.ErrNoRecording {
+		t.Fatalf("expect err: %v, actual: %v", record.ErrNoRecording, err)
+	}
+	// the mismatch, then the unused recording
+	if len(ft.errors) != 2 || !strings.Contains(ft.errors[1], "not replayed") {
+		t.Fatalf("expect 2 errors, actual: %v", ft.errors)
+	}
+	msg := ft.errors[0]
+	expectDiff := strings.Join([]string{
+		"  {",
+		`-     "name": "bob",`,
+		`+     "name": "alice",`,
+		`      "password": "<redacted sha256:16043f012da60500>"`,
+		"  }",
+	}, "\n")
+	if !strings.Contains(msg, "args of "+loginFunc+" do not match recording") || !strings.Contains(msg, expectDiff) {
+		t.Fatalf("expect diff:\n%s\nactual:\n%s", expectDiff, msg)
+	}
+	if strings.Contains(strings.Join(ft.errors, "\n"), "hunter2") {
+		t.Fatalf("expect password redacted, actual: %v", ft.errors)
+	}
+}
+
+// xgo test -run TestReplayNotReplayed -v ./test/record_replay
+func TestReplayNotReplayed(t *testing.T) {
+	t.Setenv("XGO_RECORD_MODE", record.ModeReplay)
+
+	// recorded with alice and bob
+	ft := &fakeT{TB: t, name: "TestLoginNotReplayed"}
+	record.Funcs(ft, Login)
+	token, err := Login(context.Background(), "alice", "hunter2")
+	ft.end()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "token-alice" {
+		t.Fatalf("expect token: %q, actual: %q", "token-alice", token)
+	}
+	expectErrs := []string{
+		`record: recorded call to ` + loginFunc + ` not replayed, args: {"name":"bob","password":"<redacted sha256:16043f012da60500>"}`,
+	}
+	if strings.Join(ft.errors, "\n") != strings.Join(expectErrs, "\n") {
+		t.Fatalf("expect errors:\n%s\nactual:\n%s", strings.Join(expectErrs, "\n"), strings.Join(ft.errors, "\n"))
+	}
+}
+
+// xgo test -run TestReplayHashedArgs -v ./test/record_replay
+func TestReplayHashedArgs(t *testing.T) {
+	t.Setenv("XGO_RECORD_MODE", record.ModeReplay)
+
+	// recorded with hunter2 as password of alice
+	ft := &fakeT{TB: t, name: "TestLoginNotReplayed"}
+	record.Funcs(ft, Login)
+	_, err := Login(context.Background(), "alice", "wrong")
+	ft.end()
+	if err != record.ErrNoRecording {
+		t.Fatalf("expect err: %v, actual: %v", record.ErrNoRecording, err)
+	}
+	if len(ft.errors) == 0 || !strings.Contains(ft.errors[0], "args of "+loginFunc+" do not match recording") {
+		t.Fatalf("expect args mismatch, actual: %v", ft.errors)
+	}
+}
@@ -0,0 +1,35 @@
+package trap_args
+
+import (
+	"context"
+	"errors"
+)
+
+type Greeter struct {
+	Prefix string
+}
+
+func (c Greeter) Greet(name string) string {
+	return c.Prefix + " " + name
+}
+
+func (c *Greeter) GreetPtr(name string) string {
+	return c.Prefix + " " + name
+}
+
+type ctxKey struct{}
+
+func getUser(ctx context.Context, id int) (string, error) {
+	user, _ := ctx.Value(ctxKey{}).(string)
+	if user == "" {
+		return "", errors.New("no user")
+	}
+	return user, nil
+}
+
+func length(s *string) int {
+	if s == nil {
+		return -1
+	}
+	return len(*s)
+}
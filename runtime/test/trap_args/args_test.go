@@ -0,0 +1,86 @@
+package trap_args
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/xhd2015/xgo/runtime/core"
+	"github.com/xhd2015/xgo/runtime/trap"
+)
+
+// xgo test -v ./test/trap_args
+
+func pre(fn func(args core.Object)) *trap.Interceptor {
+	return &trap.Interceptor{
+		Pre: func(ctx context.Context, f *core.FuncInfo, args, result core.Object) (data interface{}, err error) {
+			fn(args)
+			return nil, nil
+		},
+	}
+}
+
+func TestPreModifiesArg(t *testing.T) {
+	defer trap.AddFuncInterceptor(Greeter.Greet, pre(func(args core.Object) {
+		name := args.GetField("name")
+		name.Set(strings.TrimSpace(name.Value().(string)))
+	}))()
+
+	res := Greeter{Prefix: "hello"}.Greet("  world ")
+	if res != "hello world" {
+		t.Fatalf("expect sanitized arg %q, actual: %q", "hello world", res)
+	}
+}
+
+func TestPreReplacesValueReceiver(t *testing.T) {
+	defer trap.AddFuncInterceptor(Greeter.Greet, pre(func(args core.Object) {
+		args.GetField("c").Set(Greeter{Prefix: "hi"})
+	}))()
+
+	res := Greeter{Prefix: "hello"}.Greet("world")
+	if res != "hi world" {
+		t.Fatalf("expect receiver replaced, result %q, actual: %q", "hi world", res)
+	}
+}
+
+func TestPreReplacesPointerReceiver(t *testing.T) {
+	defer trap.AddFuncInterceptor((*Greeter).GreetPtr, pre(func(args core.Object) {
+		args.GetFieldIndex(0).Set(&Greeter{Prefix: "hi"})
+	}))()
+
+	g := &Greeter{Prefix: "hello"}
+	res := g.GreetPtr("world")
+	if res != "hi world" {
+		t.Fatalf("expect receiver replaced, result %q, actual: %q", "hi world", res)
+	}
+	if g.Prefix != "hello" {
+		t.Fatalf("expect original receiver untouched, actual prefix: %q", g.Prefix)
+	}
+}
+
+func TestPreReplacesCtx(t *testing.T) {
+	defer trap.AddFuncInterceptor(getUser, pre(func(args core.Object) {
+		ctx := args.GetField("ctx")
+		ctx.Set(context.WithValue(ctx.Value().(context.Context), ctxKey{}, "injected"))
+	}))()
+
+	user, err := getUser(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != "injected" {
+		t.Fatalf("expect user from injected ctx %q, actual: %q", "injected", user)
+	}
+}
+
+func TestPreSetsNil(t *testing.T) {
+	defer trap.AddFuncInterceptor(length, pre(func(args core.Object) {
+		args.GetField("s").Set(nil)
+	}))()
+
+	s := "abc"
+	n := length(&s)
+	if n != -1 {
+		t.Fatalf("expect arg set to nil, result %d, actual: %d", -1, n)
+	}
+}
@@ -0,0 +1,15 @@
+package trap_bench
+
+var count int
+
+func target() {
+	count++
+}
+
+func other() {
+	count--
+}
+
+func add(a int, b int) int {
+	return a + b
+}
@@ -0,0 +1,147 @@
+package trap_bench
+
+import (
+	"context"
+	"testing"
+
+	"github.com/xhd2015/xgo/runtime/core"
+	"github.com/xhd2015/xgo/runtime/mock"
+	"github.com/xhd2015/xgo/runtime/trap"
+)
+
+// xgo test -bench . -run TestNoAlloc -v ./test/trap_bench
+
+const numMocks = 500
+
+func addOtherMocks(n int) func() {
+	disposes := make([]func(), 0, n)
+	for i := 0; i < n; i++ {
+		disposes = append(disposes, mock.AddFuncInterceptor(other, func(ctx context.Context, fn *core.FuncInfo, args, results core.Object) error {
+			return nil
+		}))
+	}
+	return func() {
+		for _, dispose := range disposes {
+			dispose()
+		}
+	}
+}
+
+// params and results of a trapped function are moved to the
+// heap because their addresses are taken, at most one allocation
+// each, see InsertTrapForFunc. Building args costs nothing more.
+const maxAddAllocs = 3
+
+func callAdd() {
+	add(1, 2)
+}
+
+func TestNoAllocWithoutMatch(t *testing.T) {
+	baseAllocs := testing.AllocsPerRun(100, callAdd)
+	dispose := addOtherMocks(numMocks)
+	defer dispose()
+
+	allocs := testing.AllocsPerRun(100, target)
+	if allocs != 0 {
+		t.Fatalf("expect no alloc when no interceptor targets the function, actual: %v", allocs)
+	}
+	addAllocs := testing.AllocsPerRun(100, callAdd)
+	if addAllocs != baseAllocs {
+		t.Fatalf("expect args not built when no interceptor targets the function, allocs: %v, without interceptor: %v", addAllocs, baseAllocs)
+	}
+}
+
+func TestNoAllocWithoutInterceptor(t *testing.T) {
+	allocs := testing.AllocsPerRun(100, target)
+	if allocs != 0 {
+		t.Fatalf("expect no alloc when no interceptor is registered, actual: %v", allocs)
+	}
+	addAllocs := testing.AllocsPerRun(100, callAdd)
+	if addAllocs > maxAddAllocs {
+		t.Fatalf("expect at most %d allocs of params and results when no interceptor is registered, actual: %v", maxAddAllocs, addAllocs)
+	}
+}
+
+func TestLazyArgs(t *testing.T) {
+	var numField int
+	dispose := mock.AddFuncInterceptor(add, func(ctx context.Context, fn *core.FuncInfo, args, results core.Object) error {
+		numField = args.NumField()
+		results.GetFieldIndex(0).Set(args.GetField("a").Value().(int) * args.GetField("b").Value().(int))
+		return nil
+	})
+	defer dispose()
+	res := add(2, 3)
+	if res != 6 {
+		t.Fatalf("expect add(2,3) to be mocked as %d, actual: %d", 6, res)
+	}
+	if numField != 2 {
+		t.Fatalf("expect args to have %d fields, actual: %d", 2, numField)
+	}
+}
+
+func TestFuncInterceptorOnlyCalledForTarget(t *testing.T) {
+	var called int
+	dispose := trap.AddFuncInterceptor(add, &trap.Interceptor{
+		Pre: func(ctx context.Context, f *core.FuncInfo, args, result core.Object) (data interface{}, err error) {
+			called++
+			return nil, nil
+		},
+	})
+	target()
+	other()
+	res := add(1, 2)
+	if res != 3 {
+		t.Fatalf("expect add(1,2) to be %d, actual: %d", 3, res)
+	}
+	if called != 1 {
+		t.Fatalf("expect interceptor called %d time, actual: %d", 1, called)
+	}
+
+	dispose()
+	add(1, 2)
+	if called != 1 {
+		t.Fatalf("expect interceptor not called after dispose, actual: %d", called)
+	}
+}
+
+func BenchmarkNoInterceptor(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		target()
+	}
+}
+
+func BenchmarkNoInterceptorWithArgs(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		add(i, 1)
+	}
+}
+
+func BenchmarkManyMocksOnOtherFunc(b *testing.B) {
+	dispose := addOtherMocks(numMocks)
+	defer dispose()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		target()
+	}
+}
+
+func BenchmarkManyMocksOnOtherFuncWithArgs(b *testing.B) {
+	dispose := addOtherMocks(numMocks)
+	defer dispose()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		add(i, 1)
+	}
+}
+
+func BenchmarkMockedFunc(b *testing.B) {
+	dispose := mock.AddFuncInterceptor(add, func(ctx context.Context, fn *core.FuncInfo, args, results core.Object) error {
+		results.GetFieldIndex(0).Set(0)
+		return nil
+	})
+	defer dispose()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		add(i, 1)
+	}
+}
@@ -0,0 +1,17 @@
+package trap_ctx
+
+import (
+	"context"
+)
+
+type userKey struct{}
+
+func getUser(ctx context.Context) string {
+	user, _ := ctx.Value(userKey{}).(string)
+	return user
+}
+
+func hasDeadline(ctx context.Context, name string) bool {
+	_, ok := ctx.Deadline()
+	return ok
+}
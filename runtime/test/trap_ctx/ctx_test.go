@@ -0,0 +1,95 @@
+package trap_ctx
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/xhd2015/xgo/runtime/core"
+	"github.com/xhd2015/xgo/runtime/mock"
+	"github.com/xhd2015/xgo/runtime/trace"
+	"github.com/xhd2015/xgo/runtime/trap"
+)
+
+// xgo test -v ./test/trap_ctx
+
+func TestGetCtx(t *testing.T) {
+	var numField int
+	var user string
+	defer trap.AddFuncInterceptor(hasDeadline, &trap.Interceptor{
+		Pre: func(ctx context.Context, f *core.FuncInfo, args, result core.Object) (data interface{}, err error) {
+			numField = args.NumField()
+			argCtx := args.(core.ObjectWithCtx).GetCtx().Value().(context.Context)
+			user, _ = argCtx.Value(userKey{}).(string)
+			return nil, nil
+		},
+	})()
+
+	hasDeadline(context.WithValue(context.Background(), userKey{}, "alice"), "test")
+	if numField != 1 {
+		t.Fatalf("expect ctx not counted in args, NumField %d, actual: %d", 1, numField)
+	}
+	if user != "alice" {
+		t.Fatalf("expect user %q from ctx, actual: %q", "alice", user)
+	}
+}
+
+func TestReplacedCtxSeenByLaterInterceptors(t *testing.T) {
+	var seen string
+	defer trap.AddFuncInterceptor(getUser, &trap.Interceptor{
+		Phase: trap.PhaseMock,
+		Pre: func(ctx context.Context, f *core.FuncInfo, args, result core.Object) (data interface{}, err error) {
+			seen, _ = ctx.Value(userKey{}).(string)
+			return nil, nil
+		},
+	})()
+	defer mock.WithCtx(getUser, func(ctx context.Context) context.Context {
+		return context.WithValue(ctx, userKey{}, "injected")
+	})()
+
+	user := getUser(context.Background())
+	if user != "injected" {
+		t.Fatalf("expect original body to see injected ctx, user %q, actual: %q", "injected", user)
+	}
+	if seen != "injected" {
+		t.Fatalf("expect later interceptor to see injected ctx, user %q, actual: %q", "injected", seen)
+	}
+}
+
+func TestWithCtxDeadline(t *testing.T) {
+	var cancel context.CancelFunc
+	defer mock.WithCtx(hasDeadline, func(ctx context.Context) context.Context {
+		ctx, cancel = context.WithTimeout(ctx, time.Hour)
+		return ctx
+	})()
+	if !hasDeadline(context.Background(), "test") {
+		t.Fatalf("expect deadline injected")
+	}
+	cancel()
+}
+
+func TestExportCtx(t *testing.T) {
+	trace.AddCtxKey("user", userKey{})
+	var export *trace.CtxExport
+	defer trap.AddFuncInterceptor(hasDeadline, &trap.Interceptor{
+		Pre: func(ctx context.Context, f *core.FuncInfo, args, result core.Object) (data interface{}, err error) {
+			export = trace.ExportCtxArg(args)
+			return nil, nil
+		},
+	})()
+
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), userKey{}, "alice"), time.Hour)
+	defer cancel()
+	hasDeadline(ctx, "test")
+	if export == nil || export.Deadline == "" {
+		t.Fatalf("expect deadline exported, actual: %+v", export)
+	}
+	data, err := json.Marshal(export.Values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"user":"alice"}` {
+		t.Fatalf("expect values %s, actual: %s", `{"user":"alice"}`, data)
+	}
+}
@@ -0,0 +1,5 @@
+package trap_global
+
+func greet(name string) string {
+	return "hello " + name
+}
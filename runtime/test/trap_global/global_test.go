@@ -0,0 +1,82 @@
+package trap_global
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/xhd2015/xgo/runtime/core"
+	"github.com/xhd2015/xgo/runtime/trap"
+)
+
+// xgo test -race -v ./test/trap_global
+
+func TestGlobalInterceptorAfterInit(t *testing.T) {
+	var called int32
+	dispose := trap.AddGlobalInterceptor(&trap.Interceptor{
+		Pre: func(ctx context.Context, f *core.FuncInfo, args, result core.Object) (data interface{}, err error) {
+			if f.IdentityName == "greet" {
+				atomic.AddInt32(&called, 1)
+			}
+			return nil, nil
+		},
+	})
+
+	// visible to other goroutines
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		greet("world")
+	}()
+	<-done
+	if n := atomic.LoadInt32(&called); n != 1 {
+		t.Fatalf("expect global interceptor called %d time, actual: %d", 1, n)
+	}
+
+	dispose()
+	greet("world")
+	if n := atomic.LoadInt32(&called); n != 1 {
+		t.Fatalf("expect removed interceptor not called, actual: %d", n)
+	}
+}
+
+func TestGlobalFuncInterceptorRemovedInsidePre(t *testing.T) {
+	var dispose func()
+	var called int
+	dispose = trap.AddGlobalFuncInterceptor(greet, &trap.Interceptor{
+		Pre: func(ctx context.Context, f *core.FuncInfo, args, result core.Object) (data interface{}, err error) {
+			called++
+			dispose()
+			return nil, nil
+		},
+	})
+	greet("a")
+	greet("b")
+	if called != 1 {
+		t.Fatalf("expect interceptor called %d time, actual: %d", 1, called)
+	}
+}
+
+func TestConcurrentAddAndRemove(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				dispose := trap.AddGlobalInterceptor(&trap.Interceptor{
+					Pre: func(ctx context.Context, f *core.FuncInfo, args, result core.Object) (data interface{}, err error) {
+						return nil, nil
+					},
+				})
+				greet("world")
+				dispose()
+			}
+		}()
+	}
+	wg.Wait()
+	if n := len(trap.GetInterceptors()); n != 0 {
+		t.Fatalf("expect all global interceptors removed, actual: %d", n)
+	}
+}
@@ -0,0 +1,11 @@
+package trap_phase
+
+func add(a int, b int) int {
+	return a + b
+}
+
+func div(a int, b int) (int, error) {
+	return a / b, nil
+}
+
+func other() {}
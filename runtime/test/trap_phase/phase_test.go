@@ -0,0 +1,229 @@
+package trap_phase
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/xhd2015/xgo/runtime/core"
+	"github.com/xhd2015/xgo/runtime/mock"
+	"github.com/xhd2015/xgo/runtime/trace"
+	"github.com/xhd2015/xgo/runtime/trap"
+)
+
+// xgo test -v ./test/trap_phase
+
+func logInterceptor(records *[]string, name string, phase trap.Phase, abort bool) *trap.Interceptor {
+	return &trap.Interceptor{
+		Phase: phase,
+		Pre: func(ctx context.Context, f *core.FuncInfo, args, result core.Object) (data interface{}, err error) {
+			*records = append(*records, "pre "+name)
+			if abort {
+				return nil, trap.ErrAbort
+			}
+			return nil, nil
+		},
+		Post: func(ctx context.Context, f *core.FuncInfo, args, result core.Object, data interface{}) error {
+			*records = append(*records, "post "+name)
+			return nil
+		},
+	}
+}
+
+func TestPhaseOrder(t *testing.T) {
+	var records []string
+	// added in the reverse order of phases
+	defer trap.AddFuncInterceptor(add, logInterceptor(&records, "mock", trap.PhaseMock, true))()
+	defer trap.AddFuncInterceptor(add, logInterceptor(&records, "modify", trap.PhaseModify, false))()
+	defer trap.AddFuncInterceptor(add, logInterceptor(&records, "observe", trap.PhaseObserve, false))()
+
+	add(1, 2)
+
+	expect := "pre observe,pre modify,pre mock,post mock,post modify,post observe"
+	actual := strings.Join(records, ",")
+	if actual != expect {
+		t.Fatalf("expect order %q, actual: %q", expect, actual)
+	}
+}
+
+func TestSamePhaseKeepsOrder(t *testing.T) {
+	var records []string
+	defer trap.AddInterceptor(logInterceptor(&records, "first", trap.PhaseModify, false))()
+	defer trap.AddInterceptor(logInterceptor(&records, "observe", trap.PhaseObserve, false))()
+	defer trap.AddFuncInterceptor(add, logInterceptor(&records, "second", trap.PhaseModify, false))()
+
+	add(1, 2)
+
+	// most recently added runs first
+	expect := "pre observe,pre second,pre first,post first,post second,post observe"
+	actual := strings.Join(records, ",")
+	if actual != expect {
+		t.Fatalf("expect order %q, actual: %q", expect, actual)
+	}
+}
+
+func TestObserverSeesMockedResult(t *testing.T) {
+	defer mock.AddFuncInterceptor(add, func(ctx context.Context, fn *core.FuncInfo, args, results core.Object) error {
+		results.GetFieldIndex(0).Set(100)
+		return nil
+	})()
+	var observed interface{}
+	// observer added after the mock still wraps it
+	defer trap.AddInterceptor(&trap.Interceptor{
+		Phase: trap.PhaseObserve,
+		Post: func(ctx context.Context, f *core.FuncInfo, args, result core.Object, data interface{}) error {
+			observed = result.GetFieldIndex(0).Value()
+			return nil
+		},
+	})()
+
+	res := add(1, 2)
+	if res != 100 {
+		t.Fatalf("expect mocked result %d, actual: %d", 100, res)
+	}
+	if observed != 100 {
+		t.Fatalf("expect observer to see mocked result %d, actual: %v", 100, observed)
+	}
+}
+
+func failingMock(records *[]string, err error, panicking bool) *trap.Interceptor {
+	return &trap.Interceptor{
+		Phase: trap.PhaseMock,
+		Pre: func(ctx context.Context, f *core.FuncInfo, args, result core.Object) (data interface{}, e error) {
+			*records = append(*records, "pre mock")
+			if panicking {
+				panic(err)
+			}
+			return nil, err
+		},
+		Post: func(ctx context.Context, f *core.FuncInfo, args, result core.Object, data interface{}) error {
+			*records = append(*records, "post mock")
+			return nil
+		},
+	}
+}
+
+func TestPostRunsWhenPreFails(t *testing.T) {
+	var records []string
+	mockErr := errors.New("mock failed")
+	defer trap.AddFuncInterceptor(div, failingMock(&records, mockErr, false))()
+	defer trap.AddFuncInterceptor(div, logInterceptor(&records, "observe", trap.PhaseObserve, false))()
+
+	_, err := div(4, 2)
+	if err != mockErr {
+		t.Fatalf("expect err: %v, actual: %v", mockErr, err)
+	}
+	expect := "pre observe,pre mock,post observe"
+	actual := strings.Join(records, ",")
+	if actual != expect {
+		t.Fatalf("expect order %q, actual: %q", expect, actual)
+	}
+}
+
+func TestPostRunsWhenPreFailsWithoutErrResult(t *testing.T) {
+	var records []string
+	mockErr := errors.New("mock failed")
+	defer trap.AddFuncInterceptor(add, failingMock(&records, mockErr, false))()
+	defer trap.AddFuncInterceptor(add, logInterceptor(&records, "observe", trap.PhaseObserve, false))()
+
+	pe := recoverAdd()
+	if pe != mockErr {
+		t.Fatalf("expect panic: %v, actual: %v", mockErr, pe)
+	}
+	expect := "pre observe,pre mock,post observe"
+	actual := strings.Join(records, ",")
+	if actual != expect {
+		t.Fatalf("expect order %q, actual: %q", expect, actual)
+	}
+}
+
+func TestPostRunsWhenPrePanics(t *testing.T) {
+	var records []string
+	mockErr := errors.New("mock panicked")
+	defer trap.AddFuncInterceptor(add, failingMock(&records, mockErr, true))()
+	defer trap.AddFuncInterceptor(add, logInterceptor(&records, "modify", trap.PhaseModify, false))()
+	defer trap.AddFuncInterceptor(add, logInterceptor(&records, "observe", trap.PhaseObserve, false))()
+
+	pe := recoverAdd()
+	if pe != mockErr {
+		t.Fatalf("expect panic: %v, actual: %v", mockErr, pe)
+	}
+	// inner first, like a normal return
+	expect := "pre observe,pre modify,pre mock,post modify,post observe"
+	actual := strings.Join(records, ",")
+	if actual != expect {
+		t.Fatalf("expect order %q, actual: %q", expect, actual)
+	}
+}
+
+func recoverAdd() (pe interface{}) {
+	defer func() {
+		pe = recover()
+	}()
+	add(1, 2)
+	return nil
+}
+
+func TestTraceBalancedWhenMockFails(t *testing.T) {
+	t.Setenv("XGO_TRACE_OUTPUT", "stdout")
+	var roots []string
+	trace.SetMarshalStack(func(root *trace.Root) ([]byte, error) {
+		name := root.Top.FuncInfo.IdentityName
+		if root.Top.Error != nil {
+			name += ": " + root.Top.Error.Error()
+		}
+		roots = append(roots, name)
+		return []byte("{}"), nil
+	})
+	defer trace.SetMarshalStack(nil)
+	var records []string
+	defer trap.AddFuncInterceptor(div, failingMock(&records, errors.New("mock failed"), false))()
+	defer trap.AddFuncInterceptor(add, failingMock(&records, errors.New("mock panicked"), true))()
+	trace.Enable()
+	defer trace.Disable()
+
+	div(4, 2)
+	recoverAdd()
+	// not nested under the failed calls
+	div(4, 2)
+
+	expect := "div: mock failed,recoverAdd,div: mock failed"
+	actual := strings.Join(roots, ",")
+	if actual != expect {
+		t.Fatalf("expect traces %q, actual: %q", expect, actual)
+	}
+}
+
+func TestPostSeesPanic(t *testing.T) {
+	var records []string
+	mockErr := errors.New("mock panicked")
+	var seen interface{}
+	defer trap.AddFuncInterceptor(add, failingMock(&records, mockErr, true))()
+	defer trap.AddFuncInterceptor(add, &trap.Interceptor{
+		Phase: trap.PhaseObserve,
+		Post: func(ctx context.Context, f *core.FuncInfo, args, result core.Object, data interface{}) error {
+			seen, _ = trap.GetPanic(ctx)
+			return nil
+		},
+	})()
+
+	pe := recoverAdd()
+	if pe != mockErr || seen != mockErr {
+		t.Fatalf("expect panic %v raised and seen by Post, actual raised: %v, seen: %v", mockErr, pe, seen)
+	}
+
+	// no panic
+	seen = nil
+	defer trap.AddFuncInterceptor(other, &trap.Interceptor{
+		Post: func(ctx context.Context, f *core.FuncInfo, args, result core.Object, data interface{}) error {
+			_, ok := trap.GetPanic(ctx)
+			seen = ok
+			return nil
+		},
+	})()
+	other()
+	if seen != false {
+		t.Fatalf("expect no panic seen, actual: %v", seen)
+	}
+}
@@ -0,0 +1,23 @@
+package trap_reentry
+
+import "fmt"
+
+func greet(name string) string {
+	return "hello " + name
+}
+
+func format(s string) string {
+	return "<" + s + ">"
+}
+
+type codeErr struct {
+	code int
+}
+
+func (c *codeErr) Error() string {
+	return fmt.Sprintf("code %d", c.code)
+}
+
+func fail(code int) error {
+	return &codeErr{code: code}
+}
@@ -0,0 +1,117 @@
+package trap_reentry
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/xhd2015/xgo/runtime/core"
+	"github.com/xhd2015/xgo/runtime/mock"
+	"github.com/xhd2015/xgo/runtime/trap"
+)
+
+// xgo test -v ./test/trap_reentry
+
+func TestHelperCalledByMockIsObserved(t *testing.T) {
+	var calls []string
+	defer trap.AddInterceptor(&trap.Interceptor{
+		Phase: trap.PhaseObserve,
+		Pre: func(ctx context.Context, f *core.FuncInfo, args, result core.Object) (data interface{}, err error) {
+			calls = append(calls, f.IdentityName)
+			return nil, nil
+		},
+	})()
+	defer mock.AddFuncInterceptor(greet, func(ctx context.Context, fn *core.FuncInfo, args, results core.Object) error {
+		results.GetFieldIndex(0).Set(format("mock " + args.GetField("name").Value().(string)))
+		return nil
+	})()
+
+	res := greet("world")
+	if res != "<mock world>" {
+		t.Fatalf("expect greet mocked as %q, actual: %q", "<mock world>", res)
+	}
+	expect := "greet,format"
+	actual := strings.Join(calls, ",")
+	if actual != expect {
+		t.Fatalf("expect observed calls %q, actual: %q", expect, actual)
+	}
+}
+
+func TestHelperCalledByMockCanBeMocked(t *testing.T) {
+	defer mock.AddFuncInterceptor(format, func(ctx context.Context, fn *core.FuncInfo, args, results core.Object) error {
+		results.GetFieldIndex(0).Set("[" + args.GetField("s").Value().(string) + "]")
+		return nil
+	})()
+	defer mock.AddFuncInterceptor(greet, func(ctx context.Context, fn *core.FuncInfo, args, results core.Object) error {
+		results.GetFieldIndex(0).Set(format("mock"))
+		return nil
+	})()
+
+	res := greet("world")
+	if res != "[mock]" {
+		t.Fatalf("expect %q, actual: %q", "[mock]", res)
+	}
+}
+
+func TestInterceptorCallingItsTargetDoesNotRecurse(t *testing.T) {
+	var n int
+	defer mock.AddFuncInterceptor(greet, func(ctx context.Context, fn *core.FuncInfo, args, results core.Object) error {
+		n++
+		// not intercepted again by itself
+		orig := greet(args.GetField("name").Value().(string))
+		results.GetFieldIndex(0).Set(strings.ToUpper(orig))
+		return nil
+	})()
+
+	res := greet("world")
+	if res != "HELLO WORLD" {
+		t.Fatalf("expect %q, actual: %q", "HELLO WORLD", res)
+	}
+	if n != 1 {
+		t.Fatalf("expect interceptor called %d time, actual: %d", 1, n)
+	}
+}
+
+// calls an interceptor makes on its own behalf, like
+// serializing an error, are seen by other interceptors
+func TestCallsMadeByInterceptorAreObservedByOthers(t *testing.T) {
+	var encoderCalls []string
+	var errMsgs []string
+	defer trap.AddInterceptor(&trap.Interceptor{
+		Phase: trap.PhaseObserve,
+		Post: func(ctx context.Context, f *core.FuncInfo, args, result core.Object, data interface{}) error {
+			encoderCalls = append(encoderCalls, f.IdentityName)
+			if errObj, ok := result.(core.ObjectWithErr); ok {
+				if err, _ := errObj.GetErr().Value().(error); err != nil {
+					errMsgs = append(errMsgs, err.Error())
+				}
+			}
+			return nil
+		},
+	})()
+	var calls []string
+	defer trap.AddInterceptor(&trap.Interceptor{
+		Phase: trap.PhaseObserve,
+		Pre: func(ctx context.Context, f *core.FuncInfo, args, result core.Object) (data interface{}, err error) {
+			calls = append(calls, f.IdentityName)
+			return nil, nil
+		},
+	})()
+
+	err := fail(1)
+	if err == nil {
+		t.Fatalf("expect err")
+	}
+	if strings.Join(errMsgs, ",") != "code 1" {
+		t.Fatalf("expect error message %q, actual: %q", "code 1", strings.Join(errMsgs, ","))
+	}
+	// Error() is called by the first interceptor, so only the other one sees it
+	expectEncoder := "fail"
+	if strings.Join(encoderCalls, ",") != expectEncoder {
+		t.Fatalf("expect encoder calls %q, actual: %q", expectEncoder, strings.Join(encoderCalls, ","))
+	}
+	expect := "fail,(*codeErr).Error"
+	if strings.Join(calls, ",") != expect {
+		t.Fatalf("expect observed calls %q, actual: %q", expect, strings.Join(calls, ","))
+	}
+}
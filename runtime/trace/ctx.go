@@ -0,0 +1,86 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xhd2015/xgo/runtime/core"
+)
+
+type ctxKey struct {
+	name string
+	key  interface{}
+}
+
+var ctxKeysMutex sync.Mutex
+var ctxKeys atomic.Value // []ctxKey
+
+// AddCtxKey records the value of key in ctx arguments,
+// shown as name in traces. Values are serialized and
+// redacted like args.
+//
+//	trace.AddCtxKey("request_id", requestIDKey{})
+func AddCtxKey(name string, key interface{}) {
+	ctxKeysMutex.Lock()
+	defer ctxKeysMutex.Unlock()
+	keys, _ := ctxKeys.Load().([]ctxKey)
+	newKeys := make([]ctxKey, 0, len(keys)+1)
+	newKeys = append(newKeys, keys...)
+	newKeys = append(newKeys, ctxKey{name: name, key: key})
+	ctxKeys.Store(newKeys)
+}
+
+// ExportCtxArg summarizes the first context.Context argument
+// of args, nil if there is none or nothing to tell
+func ExportCtxArg(args core.Object) *CtxExport {
+	withCtx, ok := args.(core.ObjectWithCtx)
+	if !ok {
+		return nil
+	}
+	ctx, _ := withCtx.GetCtx().Value().(context.Context)
+	if ctx == nil {
+		return nil
+	}
+	return ExportCtx(ctx)
+}
+
+// ExportCtx returns the deadline, error and
+// values of keys added by AddCtxKey
+func ExportCtx(ctx context.Context) *CtxExport {
+	export := &CtxExport{}
+	empty := true
+	if deadline, ok := ctx.Deadline(); ok {
+		export.Deadline = deadline.Format(time.RFC3339Nano)
+		empty = false
+	}
+	if err := ctx.Err(); err != nil {
+		export.Err = err.Error()
+		empty = false
+	}
+	keys, _ := ctxKeys.Load().([]ctxKey)
+	if len(keys) > 0 {
+		r := getRedactor()
+		for _, k := range keys {
+			val := ctx.Value(k.key)
+			if val == nil {
+				continue
+			}
+			if export.Values == nil {
+				export.Values = make(map[string]interface{}, len(keys))
+			}
+			if r.matchName(k.name) {
+				export.Values[k.name] = redacted
+			} else {
+				export.Values[k.name] = json.RawMessage(MarshalValue(val))
+			}
+			empty = false
+		}
+	}
+	if empty {
+		return nil
+	}
+	return export
+}
@@ -0,0 +1,646 @@
+package trace
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/xhd2015/xgo/runtime/core"
+)
+
+// MarshalOptions limits the size of serialized
+// args and results, zero means no limit
+type MarshalOptions struct {
+	// max nested level of structs, maps, slices and pointers
+	MaxDepth int
+	// strings and []byte longer than this are truncated
+	MaxStringLen int
+	// elements of slices, arrays and maps beyond this are dropped
+	MaxElems int
+	// once output exceeds this size, remaining values are replaced
+	// with a placeholder
+	MaxBytes int
+}
+
+var defaultMarshalOptions = MarshalOptions{
+	MaxDepth:     16,
+	MaxStringLen: 4 * 1024,
+	MaxElems:     256,
+	MaxBytes:     1024 * 1024,
+}
+
+var marshalOptions = defaultMarshalOptions
+
+func SetMarshalOptions(opts *MarshalOptions) {
+	if opts == nil {
+		marshalOptions = defaultMarshalOptions
+		return
+	}
+	marshalOptions = *opts
+}
+
+// MarshalObject serializes args or results of a trapped
+// function into JSON.
+// Unlike json.Marshal, it never fails:
+//   - funcs, chans and unsafe pointers are replaced with type placeholders,
+//   - cyclic references are replaced with a "<cycle ...>" placeholder,
+//   - a panicking or failing MarshalJSON only affects its own field,
+//   - large values are truncated according to SetMarshalOptions,
+//   - sensitive values are redacted, see RedactNames.
+func MarshalObject(obj core.Object) []byte {
+	return newEncoder(marshalOptions).marshalObject(obj)
+}
+
+// MarshalObjectLossless is like MarshalObject, but values
+// are neither truncated nor redacted, so that the output
+// can be decoded back, e.g. by runtime/record.
+// Use RedactJSON before showing it.
+func MarshalObjectLossless(obj core.Object) []byte {
+	e := newEncoder(MarshalOptions{})
+	e.redact = noRedactor
+	return e.marshalObject(obj)
+}
+
+// MarshalObjectSalted is like MarshalObjectLossless, but values
+// to be redacted are replaced with a hash of them and salt, so
+// that the output is safe to share, while equal values still
+// serialize the same, e.g. args recorded by runtime/record.
+func MarshalObjectSalted(obj core.Object, salt string) []byte {
+	e := newEncoder(MarshalOptions{})
+	e.hashRedacted = true
+	e.salt = salt
+	return e.marshalObject(obj)
+}
+
+// RedactJSON applies redaction rules to serialized JSON,
+// e.g. the output of MarshalObjectLossless.
+// Invalid JSON is returned as is.
+func RedactJSON(data []byte) []byte {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var val interface{}
+	if err := dec.Decode(&val); err != nil {
+		return data
+	}
+	e := newEncoder(MarshalOptions{})
+	e.encode(reflect.ValueOf(val), 0)
+	return e.buf.Bytes()
+}
+
+func (c *encoder) marshalObject(obj core.Object) []byte {
+	if obj == nil {
+		return []byte("null")
+	}
+	c.buf.WriteByte('{')
+	n := obj.NumField()
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			c.buf.WriteByte(',')
+		}
+		field := obj.GetFieldIndex(i)
+		c.writeString(field.Name())
+		c.buf.WriteByte(':')
+		val, err := fieldValue(field)
+		if err != nil {
+			c.writePlaceholder(err.Error())
+			continue
+		}
+		if c.redact.matchName(field.Name()) {
+			c.writeRedacted(reflect.ValueOf(val))
+			continue
+		}
+		c.encode(reflect.ValueOf(val), 0)
+	}
+	c.buf.WriteByte('}')
+	return c.buf.Bytes()
+}
+
+// MarshalValue serializes a single value the same way MarshalObject does
+func MarshalValue(v interface{}) []byte {
+	e := newEncoder(marshalOptions)
+	e.encode(reflect.ValueOf(v), 0)
+	return e.buf.Bytes()
+}
+
+func fieldValue(field core.Field) (val interface{}, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("<panic: %v>", e)
+		}
+	}()
+	return field.Value(), nil
+}
+
+type ptrKey struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+type encoder struct {
+	buf  bytes.Buffer
+	opts MarshalOptions
+
+	// pointers and maps on the current path, used to detect cycles
+	visiting map[ptrKey]bool
+
+	redact *redactor
+	// replace redacted values with a salted hash of them
+	hashRedacted bool
+	salt         string
+}
+
+func newEncoder(opts MarshalOptions) *encoder {
+	return &encoder{
+		opts:     opts,
+		visiting: make(map[ptrKey]bool),
+		redact:   getRedactor(),
+	}
+}
+
+var marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+var jsonNumberType = reflect.TypeOf(json.Number(""))
+
+func (c *encoder) encode(v reflect.Value, depth int) {
+	if !v.IsValid() {
+		c.buf.WriteString("null")
+		return
+	}
+	if c.opts.MaxBytes > 0 && c.buf.Len() > c.opts.MaxBytes {
+		c.writePlaceholder("<truncated>")
+		return
+	}
+	t := v.Type()
+	if isTestingType(t) {
+		c.writePlaceholder("<" + t.String() + ">")
+		return
+	}
+	if c.redact.matchType(t) {
+		c.writeRedacted(v)
+		return
+	}
+	if t == jsonNumberType {
+		// from re-parsed MarshalJSON output
+		c.buf.WriteString(v.String())
+		return
+	}
+	kind := v.Kind()
+	if (kind == reflect.Ptr || kind == reflect.Interface || kind == reflect.Map || kind == reflect.Slice) && v.IsNil() {
+		c.buf.WriteString("null")
+		return
+	}
+	if kind != reflect.Interface {
+		if t.Implements(marshalerType) {
+			c.encodeMarshaler(v, depth)
+			return
+		}
+		if t.Implements(textMarshalerType) {
+			c.encodeTextMarshaler(v)
+			return
+		}
+		if t.Implements(errorType) {
+			c.encodeError(v)
+			return
+		}
+	}
+
+	switch kind {
+	case reflect.Bool:
+		c.buf.WriteString(strconv.FormatBool(v.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		c.buf.WriteString(strconv.FormatInt(v.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		c.buf.WriteString(strconv.FormatUint(v.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			c.writeString(strconv.FormatFloat(f, 'g', -1, 64))
+			return
+		}
+		bits := 64
+		if kind == reflect.Float32 {
+			bits = 32
+		}
+		c.buf.WriteString(strconv.FormatFloat(f, 'g', -1, bits))
+	case reflect.Complex64, reflect.Complex128:
+		c.writeString(strconv.FormatComplex(v.Complex(), 'g', -1, 128))
+	case reflect.String:
+		c.writeTruncatedString(v.String())
+	case reflect.Func:
+		if v.IsNil() {
+			c.buf.WriteString("null")
+			return
+		}
+		c.writePlaceholder("<func>")
+	case reflect.Chan:
+		if v.IsNil() {
+			c.buf.WriteString("null")
+			return
+		}
+		c.writePlaceholder("<" + t.String() + ">")
+	case reflect.UnsafePointer:
+		c.writePlaceholder("<unsafe.Pointer>")
+	case reflect.Interface:
+		c.encode(v.Elem(), depth)
+	case reflect.Ptr:
+		key := ptrKey{ptr: v.Pointer(), typ: t}
+		if c.visiting[key] {
+			c.writePlaceholder("<cycle " + t.String() + ">")
+			return
+		}
+		if c.opts.MaxDepth > 0 && depth >= c.opts.MaxDepth {
+			c.writePlaceholder("<max depth " + t.String() + ">")
+			return
+		}
+		c.visiting[key] = true
+		c.encode(v.Elem(), depth+1)
+		delete(c.visiting, key)
+	case reflect.Struct:
+		if c.opts.MaxDepth > 0 && depth >= c.opts.MaxDepth {
+			c.writePlaceholder("<max depth " + t.String() + ">")
+			return
+		}
+		c.buf.WriteByte('{')
+		c.encodeStructFields(v, depth, true)
+		c.buf.WriteByte('}')
+	case reflect.Map:
+		key := ptrKey{ptr: v.Pointer(), typ: t}
+		if c.visiting[key] {
+			c.writePlaceholder("<cycle " + t.String() + ">")
+			return
+		}
+		c.visiting[key] = true
+		c.encodeMap(v, depth)
+		delete(c.visiting, key)
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			c.encodeBytes(v.Bytes())
+			return
+		}
+		if v.Len() > 0 {
+			key := ptrKey{ptr: v.Pointer(), typ: t}
+			if c.visiting[key] {
+				c.writePlaceholder("<cycle " + t.String() + ">")
+				return
+			}
+			c.visiting[key] = true
+			defer delete(c.visiting, key)
+		}
+		c.encodeList(v, depth)
+	case reflect.Array:
+		c.encodeList(v, depth)
+	default:
+		c.writePlaceholder("<" + t.String() + ">")
+	}
+}
+
+// encodeStructFields writes fields without braces, so
+// that embedded structs are flattened like encoding/json does.
+// returns whether it's still at first field
+func (c *encoder) encodeStructFields(v reflect.Value, depth int, first bool) bool {
+	t := v.Type()
+	n := t.NumField()
+	for i := 0; i < n; i++ {
+		sf := t.Field(i)
+		name, omitEmpty, skip := parseJSONTag(sf)
+		if skip {
+			continue
+		}
+		fv := v.Field(i)
+		if sf.Anonymous && name == "" {
+			if fv.Kind() == reflect.Ptr && fv.Type().Elem().Kind() == reflect.Struct {
+				if fv.IsNil() {
+					continue
+				}
+				// follow embedded pointers like named ones, so
+				// that a self embedding struct cannot recurse forever
+				key := ptrKey{ptr: fv.Pointer(), typ: fv.Type()}
+				var placeholder string
+				if c.visiting[key] {
+					placeholder = "<cycle " + fv.Type().String() + ">"
+				} else if c.opts.MaxDepth > 0 && depth+1 >= c.opts.MaxDepth {
+					placeholder = "<max depth " + fv.Type().String() + ">"
+				}
+				if placeholder != "" {
+					if !first {
+						c.buf.WriteByte(',')
+					}
+					first = false
+					c.writeString(sf.Name)
+					c.buf.WriteByte(':')
+					c.writePlaceholder(placeholder)
+					continue
+				}
+				c.visiting[key] = true
+				first = c.encodeStructFields(fv.Elem(), depth+1, first)
+				delete(c.visiting, key)
+				continue
+			}
+			if fv.Kind() == reflect.Struct {
+				first = c.encodeStructFields(fv, depth, first)
+				continue
+			}
+		}
+		if sf.PkgPath != "" {
+			// unexported
+			continue
+		}
+		if omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		if !first {
+			c.buf.WriteByte(',')
+		}
+		first = false
+		c.writeString(name)
+		c.buf.WriteByte(':')
+		if hasRedactTag(sf) || c.redact.matchName(name) || c.redact.matchName(sf.Name) {
+			c.writeRedacted(fv)
+			continue
+		}
+		c.encode(fv, depth+1)
+	}
+	return first
+}
+
+func (c *encoder) encodeMap(v reflect.Value, depth int) {
+	if c.opts.MaxDepth > 0 && depth >= c.opts.MaxDepth {
+		c.writePlaceholder("<max depth " + v.Type().String() + ">")
+		return
+	}
+	type kv struct {
+		key string
+		val reflect.Value
+	}
+	keys := v.MapKeys()
+	list := make([]kv, 0, len(keys))
+	for _, k := range keys {
+		list = append(list, kv{key: formatMapKey(k), val: v.MapIndex(k)})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].key < list[j].key
+	})
+	c.buf.WriteByte('{')
+	for i, e := range list {
+		if c.opts.MaxElems > 0 && i >= c.opts.MaxElems {
+			c.buf.WriteByte(',')
+			c.writeString("...")
+			c.buf.WriteByte(':')
+			c.writeString(fmt.Sprintf("%d more", len(list)-i))
+			break
+		}
+		if i > 0 {
+			c.buf.WriteByte(',')
+		}
+		c.writeString(c.redactString(e.key))
+		c.buf.WriteByte(':')
+		if c.redact.matchName(e.key) {
+			c.writeRedacted(e.val)
+			continue
+		}
+		c.encode(e.val, depth+1)
+	}
+	c.buf.WriteByte('}')
+}
+
+func (c *encoder) encodeList(v reflect.Value, depth int) {
+	if c.opts.MaxDepth > 0 && depth >= c.opts.MaxDepth {
+		c.writePlaceholder("<max depth " + v.Type().String() + ">")
+		return
+	}
+	n := v.Len()
+	c.buf.WriteByte('[')
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			c.buf.WriteByte(',')
+		}
+		if c.opts.MaxElems > 0 && i >= c.opts.MaxElems {
+			c.writePlaceholder(fmt.Sprintf("...%d more", n-i))
+			break
+		}
+		c.encode(v.Index(i), depth+1)
+	}
+	c.buf.WriteByte(']')
+}
+
+func (c *encoder) encodeBytes(b []byte) {
+	if redactedBytes := c.redactString(string(b)); redactedBytes != string(b) {
+		b = []byte(redactedBytes)
+	}
+	if c.opts.MaxStringLen > 0 && len(b) > c.opts.MaxStringLen {
+		c.writeString(base64.StdEncoding.EncodeToString(b[:c.opts.MaxStringLen]) + fmt.Sprintf("...(truncated %d bytes)", len(b)))
+		return
+	}
+	c.writeString(base64.StdEncoding.EncodeToString(b))
+}
+
+func (c *encoder) encodeMarshaler(v reflect.Value, depth int) {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		c.buf.WriteString("null")
+		return
+	}
+	data, err := callMarshalJSON(v)
+	if err != nil {
+		c.writePlaceholder("<MarshalJSON error: " + err.Error() + ">")
+		return
+	}
+	// re-parse so that redaction and limits apply
+	// to the output as to any other value
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var val interface{}
+	err = dec.Decode(&val)
+	if err != nil {
+		c.writePlaceholder("<MarshalJSON invalid: " + err.Error() + ">")
+		return
+	}
+	c.encode(reflect.ValueOf(val), depth)
+}
+
+func (c *encoder) encodeTextMarshaler(v reflect.Value) {
+	text, err := callMarshalText(v)
+	if err != nil {
+		c.writePlaceholder("<MarshalText error: " + err.Error() + ">")
+		return
+	}
+	c.writeTruncatedString(string(text))
+}
+
+func (c *encoder) encodeError(v reflect.Value) {
+	msg, err := callError(v)
+	if err != nil {
+		c.writePlaceholder("<Error: " + err.Error() + ">")
+		return
+	}
+	c.writeTruncatedString(msg)
+}
+
+func callMarshalJSON(v reflect.Value) (data []byte, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("panic: %v", e)
+		}
+	}()
+	return v.Interface().(json.Marshaler).MarshalJSON()
+}
+
+func callMarshalText(v reflect.Value) (data []byte, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("panic: %v", e)
+		}
+	}()
+	return v.Interface().(encoding.TextMarshaler).MarshalText()
+}
+
+func callError(v reflect.Value) (msg string, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("panic: %v", e)
+		}
+	}()
+	return v.Interface().(error).Error(), nil
+}
+
+func (c *encoder) writePlaceholder(s string) {
+	c.writeString(s)
+}
+
+// writeRedacted writes the placeholder of a redacted value,
+// see MarshalObjectSalted for hashRedacted
+func (c *encoder) writeRedacted(v reflect.Value) {
+	if !c.hashRedacted {
+		c.writePlaceholder(redacted)
+		return
+	}
+	e := newEncoder(MarshalOptions{})
+	e.redact = noRedactor
+	e.encode(v, 0)
+	c.writePlaceholder(c.hashPlaceholder(e.buf.Bytes()))
+}
+
+func (c *encoder) redactString(s string) string {
+	if !c.hashRedacted {
+		return c.redact.redactString(s)
+	}
+	return c.redact.replaceString(s, func(match string) string {
+		return c.hashPlaceholder([]byte(match))
+	})
+}
+
+func (c *encoder) hashPlaceholder(data []byte) string {
+	h := sha256.New()
+	h.Write([]byte(c.salt))
+	h.Write(data)
+	return fmt.Sprintf("<redacted sha256:%x>", h.Sum(nil)[:8])
+}
+
+func (c *encoder) writeTruncatedString(s string) {
+	s = c.redactString(s)
+	if c.opts.MaxStringLen > 0 && len(s) > c.opts.MaxStringLen {
+		n := c.opts.MaxStringLen
+		// do not cut in the middle of a rune
+		for n > 0 && !utf8.RuneStart(s[n]) {
+			n--
+		}
+		s = s[:n] + fmt.Sprintf("...(truncated %d bytes)", len(s))
+	}
+	c.writeString(s)
+}
+
+func (c *encoder) writeString(s string) {
+	// encoding a string never fails
+	data, _ := marshalNoEscape(s)
+	c.buf.Write(data)
+}
+
+// marshalNoEscape is json.Marshal without escaping
+// '<', '>' and '&', which appear in placeholders
+func marshalNoEscape(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	err := enc.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	// trim the newline added by Encode
+	return bytes.TrimSuffix(buf.Bytes(), []byte{'\n'}), nil
+}
+
+func formatMapKey(k reflect.Value) string {
+	if k.Kind() == reflect.String {
+		return k.String()
+	}
+	if k.Type().Implements(textMarshalerType) {
+		text, err := callMarshalText(k)
+		if err == nil {
+			return string(text)
+		}
+	}
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10)
+	}
+	return fmt.Sprint(k.Interface())
+}
+
+func parseJSONTag(sf reflect.StructField) (name string, omitEmpty bool, skip bool) {
+	tag := sf.Tag.Get("json")
+	if tag == "-" {
+		return "", false, true
+	}
+	if tag == "" {
+		return "", false, false
+	}
+	parts := strings.Split(tag, ",")
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			omitEmpty = true
+		}
+	}
+	name = parts[0]
+	return name, omitEmpty, false
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr, reflect.Func, reflect.Chan:
+		return v.IsNil()
+	}
+	return false
+}
+
+// testing.T,testing.B... are shared with the test
+// framework and contain nothing useful for a trace
+func isTestingType(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && t.PkgPath() == "testing"
+}
@@ -0,0 +1,293 @@
+package otel
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/xhd2015/xgo/runtime/core"
+	"github.com/xhd2015/xgo/runtime/trace"
+	"github.com/xhd2015/xgo/runtime/trap"
+)
+
+const __XGO_SKIP_TRAP = true
+
+const scopeName = "github.com/xhd2015/xgo/runtime/trace/otel"
+
+// hold goroutine span stacks, keyed by goroutine ptr
+var stackMap sync.Map // uintptr(goroutine) -> *spanStack
+
+type spanStack struct {
+	traceID  string
+	top      *Span
+	finished []*Span
+}
+
+// link by compiler
+func __xgo_link_getcurg() unsafe.Pointer {
+	panic(errors.New("failed to link __xgo_link_getcurg"))
+}
+
+func __xgo_link_on_goexit(fn func()) {
+	panic("failed to link __xgo_link_on_goexit")
+}
+
+func init() {
+	func() {
+		defer func() {
+			if e := recover(); e != nil {
+				if s, ok := e.(string); ok && s == "failed to link __xgo_link_on_goexit" {
+					// silent
+					return
+				}
+				panic(e)
+			}
+		}()
+		__xgo_link_on_goexit(func() {
+			key := uintptr(__xgo_link_getcurg())
+			stackMap.Delete(key)
+		})
+	}()
+}
+
+// Enable turns every trapped call into an OpenTelemetry span.
+// Spans of the same goroutine share one trace, their parent-child
+// relationship follows the call stack. When the outermost call returns,
+// the whole trace is exported as OTLP/JSON.
+//
+// The destination is controlled by XGO_OTEL_OUTPUT:
+//   - empty: append to otel_<timestamp>.jsonl under current working directory,
+//   - stdout: write to stdout,
+//   - http://... or https://...: POST to an OTLP/HTTP collector, e.g. http://localhost:4318/v1/traces,
+//   - off: turn off the exporter,
+//   - <file>: append to <file>, one request per line.
+//
+// Setting XGO_OTEL_ARGS=true additionally records serialized
+// arguments and results as span attributes.
+func Enable() {
+	output := getOutput()
+	if output == "off" {
+		return
+	}
+	withArgs := os.Getenv("XGO_OTEL_ARGS") == "true"
+	trap.AddInterceptor(&trap.Interceptor{
+		Phase: trap.PhaseObserve,
+		Pre: func(ctx context.Context, f *core.FuncInfo, args core.Object, results core.Object) (interface{}, error) {
+			trap.Skip()
+			span := &Span{
+				SpanID:            newID(8),
+				Name:              f.DisplayName(),
+				Kind:              SpanKindInternal,
+				StartTimeUnixNano: formatNano(time.Now()),
+				Attributes:        funcAttributes(f),
+			}
+			if withArgs {
+				span.Attributes = append(span.Attributes, stringAttr("xgo.args", marshalObject(args)))
+			}
+			key := uintptr(__xgo_link_getcurg())
+			v, ok := stackMap.Load(key)
+			if !ok {
+				// initial span
+				span.TraceID = newID(16)
+				stackMap.Store(key, &spanStack{
+					traceID: span.TraceID,
+					top:     span,
+				})
+				return &spanFrame{span: span}, nil
+			}
+			stack := v.(*spanStack)
+			span.TraceID = stack.traceID
+			span.ParentSpanID = stack.top.SpanID
+			prevTop := stack.top
+			stack.top = span
+			return &spanFrame{span: span, parent: prevTop}, nil
+		},
+		Post: func(ctx context.Context, f *core.FuncInfo, args core.Object, results core.Object, data interface{}) error {
+			trap.Skip()
+			frame := data.(*spanFrame)
+			span := frame.span
+			span.EndTimeUnixNano = formatNano(time.Now())
+			if withArgs {
+				span.Attributes = append(span.Attributes, stringAttr("xgo.results", marshalObject(results)))
+			}
+			if errObj, ok := results.(core.ObjectWithErr); ok {
+				fnErr := errObj.GetErr().Value()
+				if fnErr != nil {
+					span.Status = &Status{
+						Code:    StatusCodeError,
+						Message: trace.RedactString(fnErr.(error).Error()),
+					}
+				}
+			}
+			key := uintptr(__xgo_link_getcurg())
+			v, ok := stackMap.Load(key)
+			if !ok {
+				panic(fmt.Errorf("unbalanced stack"))
+			}
+			stack := v.(*spanStack)
+			stack.finished = append(stack.finished, span)
+			if frame.parent != nil {
+				// pop stack
+				stack.top = frame.parent
+				return nil
+			}
+			// trace finished
+			stackMap.Delete(key)
+			err := export(output, stack.finished)
+			if err != nil {
+				// exporting is best effort, it should
+				// never break the traced program
+				fmt.Fprintf(os.Stderr, "xgo otel: %v\n", err)
+			}
+			return nil
+		},
+	})
+}
+
+type spanFrame struct {
+	span   *Span
+	parent *Span
+}
+
+func getOutput() string {
+	return os.Getenv("XGO_OTEL_OUTPUT")
+}
+
+func funcAttributes(f *core.FuncInfo) []*KeyValue {
+	attrs := []*KeyValue{
+		stringAttr("code.namespace", f.Pkg),
+		stringAttr("code.function", f.Name),
+	}
+	if f.RecvType != "" {
+		attrs = append(attrs,
+			stringAttr("xgo.func.recv_type", f.RecvType),
+			boolAttr("xgo.func.recv_ptr", f.RecvPtr),
+		)
+	}
+	if f.File != "" {
+		attrs = append(attrs, stringAttr("code.filepath", f.File))
+	}
+	if f.Line > 0 {
+		line := strconv.Itoa(f.Line)
+		attrs = append(attrs, &KeyValue{Key: "code.lineno", Value: &AnyValue{IntValue: &line}})
+	}
+	if f.Generic {
+		attrs = append(attrs, boolAttr("xgo.func.generic", true))
+	}
+	return attrs
+}
+
+func marshalObject(obj core.Object) string {
+	return string(trace.MarshalObject(obj))
+}
+
+func newID(n int) string {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		// fallback to time based id, should rarely happen
+		ts := uint64(time.Now().UnixNano())
+		for i := range b {
+			b[i] = byte(ts >> (8 * (uint(i) % 8)))
+		}
+	}
+	return hex.EncodeToString(b)
+}
+
+func formatNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func newRequest(spans []*Span) *ExportTraceServiceRequest {
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = filepath.Base(os.Args[0])
+	}
+	return &ExportTraceServiceRequest{
+		ResourceSpans: []*ResourceSpans{
+			{
+				Resource: &Resource{
+					Attributes: []*KeyValue{
+						stringAttr("service.name", serviceName),
+						stringAttr("telemetry.sdk.name", "xgo"),
+						stringAttr("telemetry.sdk.version", core.VERSION),
+					},
+				},
+				ScopeSpans: []*ScopeSpans{
+					{
+						Scope: &InstrumentationScope{
+							Name:    scopeName,
+							Version: core.VERSION,
+						},
+						Spans: spans,
+					},
+				},
+			},
+		},
+	}
+}
+
+var writeMutex sync.Mutex
+var defaultFile string
+
+func export(output string, spans []*Span) error {
+	data, err := json.Marshal(newRequest(spans))
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(output, "http://") || strings.HasPrefix(output, "https://") {
+		return postCollector(output, data)
+	}
+
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+	if output == "stdout" {
+		fmt.Printf("%s\n", data)
+		return nil
+	}
+	file := output
+	if file == "" {
+		if defaultFile == "" {
+			defaultFile = time.Now().Format("otel_20060102_150405.jsonl")
+		}
+		file = defaultFile
+	}
+	dir := filepath.Dir(file)
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0755)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+var httpClient = &http.Client{Timeout: 5 * time.Second}
+
+func postCollector(url string, data []byte) error {
+	resp, err := httpClient.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("otel export: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("otel export: collector responded %s", resp.Status)
+	}
+	return nil
+}
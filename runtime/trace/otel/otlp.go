@@ -0,0 +1,81 @@
+package otel
+
+// OTLP/JSON data model, see:
+// https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/trace/v1/trace.proto
+//
+// NOTE: 64-bit integers are encoded as decimal strings,
+// following the protobuf JSON mapping.
+
+type ExportTraceServiceRequest struct {
+	ResourceSpans []*ResourceSpans `json:"resourceSpans"`
+}
+
+type ResourceSpans struct {
+	Resource   *Resource     `json:"resource"`
+	ScopeSpans []*ScopeSpans `json:"scopeSpans"`
+}
+
+type Resource struct {
+	Attributes []*KeyValue `json:"attributes"`
+}
+
+type ScopeSpans struct {
+	Scope *InstrumentationScope `json:"scope"`
+	Spans []*Span               `json:"spans"`
+}
+
+type InstrumentationScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type SpanKind int
+
+const (
+	SpanKindUnspecified SpanKind = 0
+	SpanKindInternal    SpanKind = 1
+)
+
+type Span struct {
+	TraceID           string      `json:"traceId"`
+	SpanID            string      `json:"spanId"`
+	ParentSpanID      string      `json:"parentSpanId,omitempty"`
+	Name              string      `json:"name"`
+	Kind              SpanKind    `json:"kind"`
+	StartTimeUnixNano string      `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string      `json:"endTimeUnixNano"`
+	Attributes        []*KeyValue `json:"attributes,omitempty"`
+	Status            *Status     `json:"status,omitempty"`
+}
+
+type StatusCode int
+
+const (
+	StatusCodeUnset StatusCode = 0
+	StatusCodeOk    StatusCode = 1
+	StatusCodeError StatusCode = 2
+)
+
+type Status struct {
+	Message string     `json:"message,omitempty"`
+	Code    StatusCode `json:"code"`
+}
+
+type KeyValue struct {
+	Key   string    `json:"key"`
+	Value *AnyValue `json:"value"`
+}
+
+type AnyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+func stringAttr(key string, value string) *KeyValue {
+	return &KeyValue{Key: key, Value: &AnyValue{StringValue: &value}}
+}
+
+func boolAttr(key string, value bool) *KeyValue {
+	return &KeyValue{Key: key, Value: &AnyValue{BoolValue: &value}}
+}
@@ -0,0 +1,312 @@
+package trace
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const redacted = "<redacted>"
+
+// args, results, struct fields and map keys whose name
+// has any of these as a word or consecutive words, e.g.
+// "userPassword", "X-Api-Key" and "tokens" but not
+// "tokenizer", are redacted by default
+var defaultRedactNames = []string{
+	"password",
+	"passwd",
+	"token",
+	"secret",
+	"apikey",
+	"authorization",
+	"credential",
+}
+
+// RedactConfig is the format of the file
+// specified by XGO_REDACT_CONFIG
+type RedactConfig struct {
+	// names of args, results, struct fields or map keys,
+	// matched case-insensitively as substrings,
+	// ignoring '_' and '-'
+	Names []string `json:"names"`
+	// type names like "time.Duration" or "github.com/a/b.Credentials",
+	// pointers to these types are also redacted
+	Types []string `json:"types"`
+	// regular expressions, matched parts of
+	// string values are replaced
+	Patterns []string `json:"patterns"`
+	// turn off the default names
+	DisableDefault bool `json:"disableDefault"`
+}
+
+type redactor struct {
+	disableDefault bool
+	names          []string
+	types          map[string]bool
+	patterns       []*regexp.Regexp
+}
+
+// noRedactor redacts nothing
+var noRedactor = &redactor{disableDefault: true}
+
+var redactMutex sync.Mutex
+var redactValue atomic.Value // *redactor
+var redactConfigOnce sync.Once
+
+// RedactNames redacts args, results, struct fields
+// and map keys whose name contains any of names,
+// case-insensitively
+func RedactNames(names ...string) {
+	updateRedactor(func(r *redactor) {
+		for _, name := range names {
+			r.names = append(r.names, normalizeRedactName(name))
+		}
+	})
+}
+
+// RedactTypes redacts values of the given types,
+// a type is either a full name like "github.com/a/b.Credentials"
+// or the short name like "b.Credentials"
+func RedactTypes(types ...string) {
+	updateRedactor(func(r *redactor) {
+		for _, t := range types {
+			r.types[strings.TrimPrefix(t, "*")] = true
+		}
+	})
+}
+
+// RedactPattern replaces parts of string
+// values matching pattern
+func RedactPattern(pattern string) error {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+	updateRedactor(func(r *redactor) {
+		r.patterns = append(r.patterns, re)
+	})
+	return nil
+}
+
+// SetDefaultRedact turns on or off redaction of
+// common sensitive names like password, token and secret.
+// It is on by default.
+func SetDefaultRedact(enabled bool) {
+	updateRedactor(func(r *redactor) {
+		r.disableDefault = !enabled
+	})
+}
+
+// RedactString applies redaction patterns to s,
+// exporters use it for messages that are not
+// serialized args or results, e.g. error messages
+func RedactString(s string) string {
+	return getRedactor().redactString(s)
+}
+
+func updateRedactor(fn func(r *redactor)) {
+	loadRedactConfig()
+	redactMutex.Lock()
+	defer redactMutex.Unlock()
+	r := redactValue.Load().(*redactor).clone()
+	fn(r)
+	redactValue.Store(r)
+}
+
+func getRedactor() *redactor {
+	loadRedactConfig()
+	return redactValue.Load().(*redactor)
+}
+
+func loadRedactConfig() {
+	redactConfigOnce.Do(func() {
+		r := &redactor{
+			types: make(map[string]bool),
+		}
+		file := os.Getenv("XGO_REDACT_CONFIG")
+		if file != "" {
+			err := r.applyConfigFile(file)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "xgo trace: redact config %s: %v\n", file, err)
+			}
+		}
+		redactValue.Store(r)
+	})
+}
+
+func (c *redactor) applyConfigFile(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var config RedactConfig
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return err
+	}
+	for _, pattern := range config.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return err
+		}
+		c.patterns = append(c.patterns, re)
+	}
+	for _, name := range config.Names {
+		c.names = append(c.names, normalizeRedactName(name))
+	}
+	for _, t := range config.Types {
+		c.types[strings.TrimPrefix(t, "*")] = true
+	}
+	c.disableDefault = config.DisableDefault
+	return nil
+}
+
+func (c *redactor) clone() *redactor {
+	types := make(map[string]bool, len(c.types))
+	for t := range c.types {
+		types[t] = true
+	}
+	return &redactor{
+		disableDefault: c.disableDefault,
+		names:          append([]string(nil), c.names...),
+		types:          types,
+		patterns:       append([]*regexp.Regexp(nil), c.patterns...),
+	}
+}
+
+func (c *redactor) matchName(name string) bool {
+	if name == "" {
+		return false
+	}
+	if !c.disableDefault {
+		words := splitWords(name)
+		for _, n := range defaultRedactNames {
+			if matchWords(words, n) {
+				return true
+			}
+		}
+	}
+	name = normalizeRedactName(name)
+	for _, n := range c.names {
+		if n != "" && strings.Contains(name, n) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *redactor) matchType(t reflect.Type) bool {
+	if len(c.types) == 0 {
+		return false
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Name() == "" {
+		return false
+	}
+	return c.types[t.String()] || c.types[t.PkgPath()+"."+t.Name()]
+}
+
+func (c *redactor) redactString(s string) string {
+	for _, re := range c.patterns {
+		s = re.ReplaceAllString(s, redacted)
+	}
+	return s
+}
+
+// replaceString is like redactString, but matched
+// parts are replaced with what repl returns
+func (c *redactor) replaceString(s string, repl func(match string) string) string {
+	for _, re := range c.patterns {
+		s = re.ReplaceAllStringFunc(s, repl)
+	}
+	return s
+}
+
+func hasRedactTag(sf reflect.StructField) bool {
+	for _, opt := range strings.Split(sf.Tag.Get("xgo"), ",") {
+		if opt == "redact" {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeRedactName(name string) string {
+	name = strings.ToLower(name)
+	name = strings.ReplaceAll(name, "_", "")
+	name = strings.ReplaceAll(name, "-", "")
+	return name
+}
+
+// splitWords splits camelCase, snake_case and kebab-case
+// names into lower case words, "APIKey" gives "api" and "key"
+func splitWords(name string) []string {
+	var words []string
+	start := 0
+	flush := func(end int) {
+		if end > start {
+			words = append(words, strings.ToLower(name[start:end]))
+		}
+	}
+	for i := 0; i < len(name); i++ {
+		ch := name[i]
+		if ch == '_' || ch == '-' || ch == '.' || ch == ' ' {
+			flush(i)
+			start = i + 1
+			continue
+		}
+		if i == start {
+			continue
+		}
+		if isDigit(ch) != isDigit(name[i-1]) {
+			flush(i)
+			start = i
+			continue
+		}
+		if !isUpper(ch) {
+			continue
+		}
+		prev := name[i-1]
+		// aB, or the B of ABc
+		if !isUpper(prev) || (i+1 < len(name) && isLower(name[i+1])) {
+			flush(i)
+			start = i
+		}
+	}
+	flush(len(name))
+	return words
+}
+
+// matchWords reports whether n equals one or more
+// consecutive words, optionally in plural
+func matchWords(words []string, n string) bool {
+	for i := range words {
+		joined := ""
+		for j := i; j < len(words) && len(joined) < len(n); j++ {
+			joined += words[j]
+			if joined == n || joined == n+"s" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isUpper(ch byte) bool {
+	return ch >= 'A' && ch <= 'Z'
+}
+
+func isLower(ch byte) bool {
+	return ch >= 'a' && ch <= 'z'
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
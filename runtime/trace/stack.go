@@ -1,9 +1,11 @@
 package trace
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/xhd2015/xgo/runtime/core"
+	"github.com/xhd2015/xgo/runtime/trap"
 )
 
 type Root struct {
@@ -16,13 +18,21 @@ type Root struct {
 type Stack struct {
 	FuncInfo *core.FuncInfo
 
-	Begin int64 // us
-	End   int64 // us
+	Begin int64 // ns, since Root.Begin
+	End   int64 // ns, since Root.Begin
 
 	Args    core.Object
 	Results core.Object
-	Panic   bool
-	Error   error
+	// serialized Args at call time and Results at
+	// return time, only set in snapshot mode
+	ArgsSnapshot    []byte
+	ResultsSnapshot []byte
+	Panic           bool
+	Error           error
+	// where the function is called, nil if unknown
+	CallSite *trap.CallSite
+	// summary of the ctx argument at call time
+	Ctx *CtxExport
 	// Recv     interface{}
 	// Args     []interface{}
 	// Results  []interface{}
@@ -59,18 +69,41 @@ func (c *Stack) Export() *StackExport {
 	}
 	var errMsg string
 	if c.Error != nil {
-		errMsg = c.Error.Error()
+		errMsg = RedactString(c.Error.Error())
 	}
-	return &StackExport{
+	stack := &StackExport{
 		FuncInfo: ExportFuncInfo(c.FuncInfo),
 		Begin:    c.Begin,
 		End:      c.End,
-		Args:     c.Args,
-		Results:  c.Results,
+		Args:     exportArgs(c.Args, c.ArgsSnapshot),
+		Results:  exportArgs(c.Results, c.ResultsSnapshot),
 		Panic:    c.Panic,
 		Error:    errMsg,
+		Ctx:      c.Ctx,
 		Children: (stacks)(c.Children).Export(),
 	}
+	if c.CallSite != nil {
+		stack.CallFile = c.CallSite.File
+		stack.CallLine = c.CallSite.Line
+	}
+	return stack
+}
+
+// marshalArgs serializes args or results ahead of
+// json.Marshal, so an unserializable value only
+// affects its own field
+func marshalArgs(obj core.Object) interface{} {
+	if obj == nil {
+		return nil
+	}
+	return json.RawMessage(MarshalObject(obj))
+}
+
+func exportArgs(obj core.Object, snapshot []byte) interface{} {
+	if snapshot != nil {
+		return json.RawMessage(snapshot)
+	}
+	return marshalArgs(obj)
 }
 
 func ExportFuncInfo(c *core.FuncInfo) *FuncInfoExport {
@@ -84,7 +117,12 @@ func ExportFuncInfo(c *core.FuncInfo) *FuncInfoExport {
 		RecvType:     c.RecvType,
 		RecvPtr:      c.RecvPtr,
 
-		Generic:  c.Generic,
+		Generic: c.Generic,
+
+		File:    c.File,
+		Line:    c.Line,
+		EndLine: c.EndLine,
+
 		RecvName: c.RecvName,
 		ArgNames: c.ArgNames,
 		ResNames: c.ResNames,
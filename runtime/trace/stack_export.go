@@ -12,17 +12,32 @@ type RootExport struct {
 type StackExport struct {
 	FuncInfo *FuncInfoExport
 
-	Begin int64 // us
-	End   int64 // us
+	Begin int64 // ns, since Root.Begin
+	End   int64 // ns, since Root.Begin
 
 	Args    interface{}
 	Results interface{}
 	Panic   bool
 	Error   string
 
+	// where the function is called
+	CallFile string `json:",omitempty"`
+	CallLine int    `json:",omitempty"`
+
+	// the first context.Context argument at call time
+	Ctx *CtxExport `json:",omitempty"`
+
 	Children []*StackExport
 }
 
+// CtxExport summarizes a context.Context
+type CtxExport struct {
+	Deadline string `json:",omitempty"` // RFC3339Nano
+	Err      string `json:",omitempty"`
+	// values of keys added by AddCtxKey, by name
+	Values map[string]interface{} `json:",omitempty"`
+}
+
 type FuncInfoExport struct {
 	// FullName string
 	Pkg          string
@@ -33,6 +48,11 @@ type FuncInfoExport struct {
 
 	Generic bool
 
+	// source info, empty if unknown
+	File    string `json:",omitempty"`
+	Line    int    `json:",omitempty"`
+	EndLine int    `json:",omitempty"`
+
 	RecvName string
 	ArgNames []string
 	ResNames []string
@@ -42,3 +62,31 @@ type FuncInfoExport struct {
 	// last last result error
 	LastResultErr bool
 }
+
+// StackEvent is one line of a streamed trace,
+// see XGO_TRACE_STREAM.
+// A stream starts with a "begin" event, followed by
+// "enter" and "exit" events of each call.
+type StackEvent struct {
+	Kind string // begin,enter,exit
+
+	// goroutine which makes the call
+	G string `json:",omitempty"`
+	// ID is shared by the enter and exit event of the same call
+	ID       int64 `json:",omitempty"`
+	ParentID int64 `json:",omitempty"`
+	// test name, only for top level enter
+	Test string `json:",omitempty"`
+
+	Begin *time.Time `json:",omitempty"` // begin only
+	Time  int64      // ns, since Begin
+
+	FuncInfo *FuncInfoExport `json:",omitempty"` // enter only
+	CallFile string          `json:",omitempty"` // enter only
+	CallLine int             `json:",omitempty"` // enter only
+	Ctx      *CtxExport      `json:",omitempty"` // enter only
+	Args     interface{}     `json:",omitempty"` // enter only
+	Results  interface{}     `json:",omitempty"` // exit only
+	Panic    bool            `json:",omitempty"`
+	Error    string          `json:",omitempty"`
+}
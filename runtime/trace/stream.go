@@ -0,0 +1,250 @@
+package trace
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xhd2015/xgo/runtime/core"
+	"github.com/xhd2015/xgo/runtime/trap"
+)
+
+// in streaming mode, instead of holding the whole
+// tree in memory until the top frame returns, each
+// goroutine only holds ids of its current stack
+var streamStackMap sync.Map // uintptr(goroutine) -> *streamStack
+
+type streamStack struct {
+	g   string
+	ids []int64
+}
+
+var streamID int64
+
+const streamBufferSize = 64 * 1024
+const streamFlushInterval = time.Second
+
+func isStreaming() bool {
+	return os.Getenv("XGO_TRACE_STREAM") == "true"
+}
+
+// enableStream returns a func that removes the
+// interceptor and flushes and closes the output
+func enableStream() func() {
+	w, err := newStreamWriter(getTraceOutput())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "xgo trace: %v\n", err)
+		return func() {}
+	}
+	dispose := trap.AddInterceptor(&trap.Interceptor{
+		Phase:    trap.PhaseObserve,
+		CallSite: true,
+		Pre: func(ctx context.Context, f *core.FuncInfo, args core.Object, results core.Object) (interface{}, error) {
+			trap.Skip()
+			key := uintptr(__xgo_link_getcurg())
+			var stack *streamStack
+			v, ok := streamStackMap.Load(key)
+			if ok {
+				stack = v.(*streamStack)
+			} else {
+				stack = &streamStack{
+					g: fmt.Sprintf("g_%x", key),
+				}
+				streamStackMap.Store(key, stack)
+			}
+			event := &StackEvent{
+				Kind:     "enter",
+				G:        stack.g,
+				ID:       atomic.AddInt64(&streamID, 1),
+				Time:     int64(time.Since(w.begin)),
+				FuncInfo: ExportFuncInfo(f),
+				Ctx:      ExportCtxArg(args),
+				Args:     marshalArgs(args),
+			}
+			if site := trap.GetCallSite(ctx); site != nil {
+				event.CallFile = site.File
+				event.CallLine = site.Line
+			}
+			if len(stack.ids) > 0 {
+				event.ParentID = stack.ids[len(stack.ids)-1]
+			} else {
+				tinfo, ok := testInfoMaping.Load(key)
+				if ok {
+					event.Test = tinfo.(*testInfo).name
+				}
+			}
+			stack.ids = append(stack.ids, event.ID)
+			w.write(event, false)
+			return nil, nil
+		},
+		Post: func(ctx context.Context, f *core.FuncInfo, args core.Object, results core.Object, data interface{}) error {
+			trap.Skip()
+			key := uintptr(__xgo_link_getcurg())
+			v, ok := streamStackMap.Load(key)
+			if !ok {
+				panic(fmt.Errorf("unbalanced stack"))
+			}
+			stack := v.(*streamStack)
+			n := len(stack.ids)
+			if n == 0 {
+				panic(fmt.Errorf("unbalanced stack"))
+			}
+			event := &StackEvent{
+				Kind:    "exit",
+				G:       stack.g,
+				ID:      stack.ids[n-1],
+				Time:    int64(time.Since(w.begin)),
+				Results: marshalArgs(results),
+			}
+			if errObj, ok := results.(core.ObjectWithErr); ok {
+				fnErr := errObj.GetErr().Value()
+				if fnErr != nil {
+					event.Error = RedactString(fnErr.(error).Error())
+				}
+			}
+			stack.ids = stack.ids[:n-1]
+			if n == 1 {
+				streamStackMap.Delete(key)
+			}
+			// top frame exited, flush immediately
+			w.write(event, n == 1)
+			return nil
+		},
+	})
+	return func() {
+		dispose()
+		w.close()
+	}
+}
+
+type streamWriter struct {
+	mutex  sync.Mutex
+	w      *bufio.Writer
+	out    io.Writer
+	begin  time.Time
+	closed bool
+	done   chan struct{}
+}
+
+func newStreamWriter(xgoTraceOutput string) (*streamWriter, error) {
+	begin := time.Now()
+	var out io.Writer
+	if xgoTraceOutput == "stdout" {
+		out = os.Stdout
+	} else {
+		file := begin.Format("trace_20060102_150405.jsonl")
+		if xgoTraceOutput != "" {
+			file = filepath.Join(xgoTraceOutput, file)
+		}
+		err := os.MkdirAll(filepath.Dir(file), 0755)
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+		if err != nil {
+			return nil, err
+		}
+		out = f
+	}
+	w := &streamWriter{
+		w:     bufio.NewWriterSize(out, streamBufferSize),
+		out:   out,
+		begin: begin,
+		done:  make(chan struct{}),
+	}
+	w.write(&StackEvent{
+		Kind:  "begin",
+		Begin: &begin,
+	}, true)
+	go w.flushLoop()
+	return w, nil
+}
+
+// write never blocks on a full buffer longer than
+// a single flush, so memory held is bounded by
+// streamBufferSize
+func (c *streamWriter) write(event *StackEvent, flush bool) {
+	data := marshalEvent(event)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return
+	}
+	c.w.Write(data)
+	c.w.WriteByte('\n')
+	if flush {
+		c.w.Flush()
+	}
+}
+
+// flushLoop bounds how long an event stays in the buffer,
+// e.g. of a goroutine that never returns to its top frame
+func (c *streamWriter) flushLoop() {
+	ticker := time.NewTicker(streamFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.flush()
+		}
+	}
+}
+
+func (c *streamWriter) flush() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return
+	}
+	c.w.Flush()
+}
+
+func (c *streamWriter) close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	close(c.done)
+	c.w.Flush()
+	if f, ok := c.out.(*os.File); ok && f != os.Stdout {
+		f.Close()
+	}
+}
+
+func marshalEvent(event *StackEvent) (data []byte) {
+	defer func() {
+		if e := recover(); e != nil {
+			data = marshalEventWithoutValues(event, fmt.Errorf("panic: %v", e))
+		}
+	}()
+	data, err := marshalNoEscape(event)
+	if err != nil {
+		return marshalEventWithoutValues(event, err)
+	}
+	return data
+}
+
+// marshalEventWithoutValues keeps the event in the
+// stream when args or results cannot be serialized
+func marshalEventWithoutValues(event *StackEvent, err error) []byte {
+	copied := *event
+	if copied.Args != nil {
+		copied.Args = "error:" + err.Error()
+	}
+	if copied.Results != nil {
+		copied.Results = "error:" + err.Error()
+	}
+	data, _ := marshalNoEscape(&copied)
+	return data
+}
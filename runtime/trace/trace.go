@@ -2,7 +2,6 @@ package trace
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
@@ -41,6 +40,7 @@ func init() {
 	__xgo_link_on_goexit(func() {
 		key := uintptr(__xgo_link_getcurg())
 		testInfoMaping.Delete(key)
+		streamStackMap.Delete(key)
 	})
 }
 
@@ -57,22 +57,65 @@ func __xgo_link_on_goexit(fn func()) {
 	panic("failed to link __xgo_link_on_goexit")
 }
 
+var enableMutex sync.Mutex
+var disableTrace func()
+
+// Enable collects traces of all trapped calls.
+// By default the whole call tree is kept in memory
+// and emitted when the top frame returns.
+// With XGO_TRACE_STREAM=true, enter and exit events
+// are written incrementally as JSON Lines instead,
+// which suits long-running goroutines.
 func Enable() {
 	if getTraceOutput() == "off" {
 		return
 	}
+	enableMutex.Lock()
+	defer enableMutex.Unlock()
+	if disableTrace != nil {
+		return
+	}
+	if isStreaming() {
+		disableTrace = enableStream()
+		return
+	}
+	disableTrace = enableTree()
+}
+
+// Disable stops collecting traces started by Enable.
+// In streaming mode, buffered events are flushed and
+// the output is closed, so call it before os.Exit.
+func Disable() {
+	enableMutex.Lock()
+	defer enableMutex.Unlock()
+	if disableTrace == nil {
+		return
+	}
+	disableTrace()
+	disableTrace = nil
+}
+
+func enableTree() func() {
+	withSnapshot := isSnapshot()
 	// collect trace
-	trap.AddInterceptor(&trap.Interceptor{
+	return trap.AddInterceptor(&trap.Interceptor{
+		Phase:    trap.PhaseObserve,
+		CallSite: true,
 		Pre: func(ctx context.Context, f *core.FuncInfo, args core.Object, results core.Object) (interface{}, error) {
 			trap.Skip()
 			stack := &Stack{
 				FuncInfo: f,
 				Args:     args,
 				Results:  results,
+				CallSite: trap.GetCallSite(ctx),
+				Ctx:      ExportCtxArg(args),
 				// Recv:     args.Recv,
 				// Args:     args.Args,
 				// Results:  args.Results,
 			}
+			if withSnapshot {
+				stack.ArgsSnapshot = MarshalObject(args)
+			}
 			key := uintptr(__xgo_link_getcurg())
 			v, ok := stackMap.Load(key)
 			if !ok {
@@ -109,7 +152,14 @@ func Enable() {
 					root.Top.Error = fnErr.(error)
 				}
 			}
+			if pe, ok := trap.GetPanic(ctx); ok {
+				root.Top.Panic = true
+				root.Top.Error = fmt.Errorf("panic: %v", pe)
+			}
 			root.Top.End = int64(time.Since(root.Begin))
+			if withSnapshot {
+				root.Top.ResultsSnapshot = MarshalObject(results)
+			}
 			if data == nil {
 				// stack finished
 				stackMap.Delete(key)
@@ -133,6 +183,23 @@ func getTraceOutput() string {
 	return os.Getenv("XGO_TRACE_OUTPUT")
 }
 
+var snapshot bool
+
+// SetSnapshot makes trace serialize args when a function
+// is called and results when it returns, instead of when
+// the trace is emitted, so later mutations of slices, maps
+// or pointed values do not show up in the recorded values.
+// It can also be turned on by XGO_TRACE_SNAPSHOT=true.
+// Must be called before Enable.
+// Streaming mode always serializes at call and return time.
+func SetSnapshot(v bool) {
+	snapshot = v
+}
+
+func isSnapshot() bool {
+	return snapshot || os.Getenv("XGO_TRACE_SNAPSHOT") == "true"
+}
+
 var marshalStack func(root *Root) ([]byte, error)
 
 func SetMarshalStack(fn func(root *Root) ([]byte, error)) {
@@ -153,7 +220,7 @@ func fmtStack(root *Root) (data []byte, err error) {
 	if marshalStack != nil {
 		return marshalStack(root)
 	}
-	return json.Marshal(root.Export())
+	return marshalNoEscape(root.Export())
 }
 
 // this should also be marked as trap.Skip()
@@ -196,7 +263,7 @@ func emitTrace(root *Root) error {
 	}
 
 	if useStdout {
-		fmt.Print(traceOut)
+		fmt.Printf("%s\n", traceOut)
 		return nil
 	}
 
@@ -0,0 +1,68 @@
+package trap
+
+import (
+	"context"
+	"runtime"
+
+	"github.com/xhd2015/xgo/runtime/core"
+	"github.com/xhd2015/xgo/runtime/functab"
+)
+
+// CallSite describes where a trapped function is called
+type CallSite struct {
+	PC       uintptr // return address in the caller
+	File     string
+	Line     int
+	FuncName string // full name of caller, as in runtime.Frame.Function
+
+	// caller's FuncInfo, nil if the caller is not registered,
+	// e.g. std lib functions or generic functions
+	Func *core.FuncInfo
+}
+
+type callSiteKeyType struct{}
+
+var callSiteKey = callSiteKeyType{}
+
+// GetCallSite returns the call site of the trapped function,
+// ctx must be the one passed to Pre or Post of an interceptor
+// with CallSite set, otherwise nil is returned.
+func GetCallSite(ctx context.Context) *CallSite {
+	if ctx == nil {
+		return nil
+	}
+	site, _ := ctx.Value(callSiteKey).(*CallSite)
+	return site
+}
+
+// tells the runtime to pass the caller pc of
+// trapped functions, see __xgo_trap
+func __xgo_link_enable_trap_callsite() {
+	panic("failed to link __xgo_link_enable_trap_callsite")
+}
+
+func enableCallSite(interceptor *Interceptor) {
+	if interceptor.CallSite {
+		__xgo_link_enable_trap_callsite()
+	}
+}
+
+// getCallSite resolves callerPC, the return address
+// of the trapped function passed by __xgo_trap
+func getCallSite(callerPC uintptr) *CallSite {
+	if callerPC == 0 {
+		return nil
+	}
+	// the innermost frame if the call is inlined
+	frame, _ := runtime.CallersFrames([]uintptr{callerPC}).Next()
+	site := &CallSite{
+		PC:       frame.PC,
+		File:     frame.File,
+		Line:     frame.Line,
+		FuncName: frame.Function,
+	}
+	if frame.Entry != 0 {
+		site.Func = functab.InfoPC(frame.Entry)
+	}
+	return site
+}
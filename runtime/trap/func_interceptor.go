@@ -0,0 +1,202 @@
+package trap
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/xhd2015/xgo/runtime/core"
+)
+
+// funcKey identifies a trapped function, by entry pc for
+// normal functions, by name for generic functions
+// because all instances share the same FuncInfo
+type funcKey struct {
+	pc           uintptr
+	pkgPath      string
+	identityName string
+}
+
+func (c funcKey) generic() bool {
+	return c.identityName != ""
+}
+
+// AddFuncInterceptor adds an interceptor which is only called
+// when fn is called. Unlike AddInterceptor, the cost of other
+// functions does not grow with the number of such interceptors.
+// Like AddInterceptor, it is global if called from init,
+// otherwise local to current goroutine and returns a dispose func.
+func AddFuncInterceptor(fn interface{}, interceptor *Interceptor) func() {
+	return addFuncInterceptor(funcKey{pc: getFuncPC(fn)}, interceptor)
+}
+
+func getFuncPC(fn interface{}) uintptr {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		panic(fmt.Errorf("given type is not a func: %T", fn))
+	}
+	return v.Pointer()
+}
+
+// AddGlobalFuncInterceptor is like AddFuncInterceptor, but the
+// interceptor is always global and can be added at any time.
+func AddGlobalFuncInterceptor(fn interface{}, interceptor *Interceptor) func() {
+	ensureInit()
+	key := funcKey{pc: getFuncPC(fn)}
+	return addGlobal(&key, interceptor)
+}
+
+// AddFuncInfoInterceptor is like AddFuncInterceptor, it also
+// works for generic functions, f is usually got from functab.
+func AddFuncInfoInterceptor(f *core.FuncInfo, interceptor *Interceptor) func() {
+	if f == nil {
+		panic(fmt.Errorf("nil FuncInfo"))
+	}
+	return addFuncInterceptor(getFuncInfoKey(f), interceptor)
+}
+
+func getFuncInfoKey(f *core.FuncInfo) funcKey {
+	if f.Generic {
+		return funcKey{pkgPath: f.Pkg, identityName: f.IdentityName}
+	}
+	return funcKey{pc: f.PC}
+}
+
+func addFuncInterceptor(key funcKey, interceptor *Interceptor) func() {
+	ensureInit()
+	if key.pc == 0 && key.identityName == "" {
+		panic(fmt.Errorf("func key is empty"))
+	}
+	if __xgo_link_init_finished() {
+		return addLocalFuncInterceptor(key, interceptor)
+	}
+	return addGlobal(&key, interceptor)
+}
+
+func addLocalFuncInterceptor(key funcKey, interceptor *Interceptor) func() {
+	goKey, list := getOrCreateLocalList()
+	if list.funcs == nil {
+		list.funcs = make(map[funcKey][]*Interceptor)
+	}
+	if len(list.funcs[key]) == 0 && key.generic() {
+		list.generic++
+	}
+	list.funcs[key] = append(list.funcs[key], interceptor)
+	__xgo_link_add_trap_active(1)
+	enableCallSite(interceptor)
+
+	removed := false
+	return func() {
+		if removed {
+			panic(fmt.Errorf("remove interceptor more than once"))
+		}
+		removed = true
+		fnList := removeInterceptor(list.funcs[key], interceptor)
+		if len(fnList) == 0 {
+			delete(list.funcs, key)
+			if key.generic() {
+				list.generic--
+			}
+		} else {
+			list.funcs[key] = fnList
+		}
+		list.release(1)
+		deleteLocalListIfEmpty(goKey, list)
+	}
+}
+
+// mayTrap is called by the runtime before args of a trapped
+// function are built, so that functions no interceptor can
+// apply to do not pay for them. It may report false positives:
+// generic functions are keyed by name, which is not known here.
+// xgo:notrap
+func mayTrap(pc uintptr) bool {
+	globals := loadGlobals()
+	if len(globals.interceptors) > 0 || globals.generic > 0 {
+		return true
+	}
+	key := funcKey{pc: pc}
+	if len(globals.funcs[key]) > 0 {
+		return true
+	}
+	list := getLocalList()
+	if list == nil {
+		return false
+	}
+	return len(list.interceptors) > 0 || list.generic > 0 || len(list.funcs[key]) > 0
+}
+
+// getInterceptors returns interceptors for the function,
+// in the order of: global, global func, local, local func,
+// Pre runs in reverse order so local func ones run first.
+// It does not allocate unless more than one source is non-empty.
+// With funcOnly, interceptors for all functions are left out.
+func getInterceptors(globals *registry, key funcKey, funcOnly bool) []*Interceptor {
+	var sources [4][]*Interceptor
+	if !funcOnly {
+		sources[0] = globals.interceptors
+	}
+	if len(globals.funcs) > 0 {
+		sources[1] = globals.funcs[key]
+	}
+	if list := getLocalList(); list != nil {
+		if !funcOnly {
+			sources[2] = list.interceptors
+		}
+		if len(list.funcs) > 0 {
+			sources[3] = list.funcs[key]
+		}
+	}
+	var result []*Interceptor
+	var n int
+	for _, src := range sources {
+		if len(src) == 0 {
+			continue
+		}
+		n++
+		if n == 1 {
+			result = src
+			continue
+		}
+		if n == 2 {
+			// copy to avoid modifying the source
+			result = append(make([]*Interceptor, 0, len(result)+len(src)), result...)
+		}
+		result = append(result, src...)
+	}
+	return result
+}
+
+// sortByPhase orders interceptors by phase descending, since
+// Pre runs from the last one, observers run first.
+// The order within a phase is kept, list is copied
+// only if not already sorted.
+func sortByPhase(list []*Interceptor) []*Interceptor {
+	sorted := true
+	for i := 1; i < len(list); i++ {
+		if list[i].Phase > list[i-1].Phase {
+			sorted = false
+			break
+		}
+	}
+	if sorted {
+		return list
+	}
+	result := make([]*Interceptor, len(list))
+	copy(result, list)
+	// insertion sort is stable, and lists are short
+	for i := 1; i < len(result); i++ {
+		for j := i; j > 0 && result[j].Phase > result[j-1].Phase; j-- {
+			result[j], result[j-1] = result[j-1], result[j]
+		}
+	}
+	return result
+}
+
+// isStdPkg reports whether pkgPath is a std package whose
+// functions are trapped with xgo --mock-clock, see stdTrapFuncs
+// in patch/trap.go. Only interceptors added for these functions,
+// like runtime/mockclock, apply to them, so trace does not
+// record time.Now called by user code.
+func isStdPkg(pkgPath string) bool {
+	return pkgPath == "time"
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"unsafe"
 
 	"github.com/xhd2015/xgo/runtime/core"
@@ -27,6 +28,12 @@ func __xgo_link_on_goexit(fn func()) {
 	panic("failed to link __xgo_link_on_goexit")
 }
 
+// tells the runtime whether any interceptor exists,
+// trapped functions skip building args when none
+func __xgo_link_add_trap_active(n int32) {
+	panic("failed to link __xgo_link_add_trap_active")
+}
+
 func init() {
 	func() {
 		defer func() {
@@ -38,27 +45,61 @@ func init() {
 				panic(e)
 			}
 		}()
-		__xgo_link_on_goexit(clearLocalInterceptorsAndMark)
+		__xgo_link_on_goexit(clearLocalInterceptorsAndActive)
 	}()
 }
 
+// Phase decides the order of interceptors of a call:
+// Pre runs observers first, then modifiers, then mocks,
+// Post runs in the reverse order, so observers like trace
+// always wrap mocks and see the mocked results.
+// Within the same phase, Pre of the most recently added runs
+// first, local interceptors run before global ones.
+type Phase int
+
+const (
+	PhaseObserve Phase = -1 // only looks at args and results, e.g. trace
+	PhaseModify  Phase = 0  // the default, may change args or results
+	PhaseMock    Phase = 1  // replaces the function, usually aborts
+)
+
 type Interceptor struct {
 	Pre  func(ctx context.Context, f *core.FuncInfo, args core.Object, result core.Object) (data interface{}, err error)
 	Post func(ctx context.Context, f *core.FuncInfo, args core.Object, result core.Object, data interface{}) error
+
+	Phase Phase
+
+	// CallSite makes the caller's position available
+	// to Pre and Post via GetCallSite(ctx).
+	// It is off by default because walking the stack
+	// on each call is not free.
+	CallSite bool
 }
 
-var interceptors []*Interceptor
 var localInterceptors sync.Map // goroutine ptr -> *interceptorList
 
+// number of goroutines having local interceptors,
+// lets trap skip looking up localInterceptors
+var localListCount int32
+
+// AddInterceptor adds a global interceptor if called from init,
+// otherwise a local interceptor of current goroutine.
+// The returned func removes it.
 func AddInterceptor(interceptor *Interceptor) func() {
 	ensureInit()
 	if __xgo_link_init_finished() {
 		return addLocalInterceptor(interceptor)
 	}
-	interceptors = append(interceptors, interceptor)
-	return func() {
-		panic("global interceptor cannot be cancelled")
-	}
+	return addGlobal(nil, interceptor)
+}
+
+// AddGlobalInterceptor adds an interceptor effective for
+// all goroutines. Unlike AddInterceptor, it can be called at
+// any time, e.g. by a test installing process-wide hooks,
+// which should call the returned func to clean up.
+func AddGlobalInterceptor(interceptor *Interceptor) func() {
+	ensureInit()
+	return addGlobal(nil, interceptor)
 }
 
 func WithInterceptor(interceptor *Interceptor, f func()) {
@@ -71,20 +112,19 @@ func WithInterceptor(interceptor *Interceptor, f func()) {
 }
 
 func GetInterceptors() []*Interceptor {
-	return interceptors
+	return loadGlobals().interceptors
 }
 
 func GetLocalInterceptors() []*Interceptor {
-	key := __xgo_link_getcurg()
-	val, ok := localInterceptors.Load(key)
-	if !ok {
+	list := getLocalList()
+	if list == nil {
 		return nil
 	}
-	return val.(*interceptorList).interceptors
+	return list.interceptors
 }
 
 func ClearLocalInterceptors() {
-	clearLocalInterceptorsAndMark()
+	clearLocalInterceptorsAndActive()
 }
 
 func GetAllInterceptors() []*Interceptor {
@@ -104,13 +144,10 @@ func GetAllInterceptors() []*Interceptor {
 // NOTE: if not called correctly,there might be memory leak
 func addLocalInterceptor(interceptor *Interceptor) func() {
 	ensureInit()
-	key := __xgo_link_getcurg()
-	list := &interceptorList{}
-	val, loaded := localInterceptors.LoadOrStore(key, list)
-	if loaded {
-		list = val.(*interceptorList)
-	}
+	key, list := getOrCreateLocalList()
 	list.interceptors = append(list.interceptors, interceptor)
+	__xgo_link_add_trap_active(1)
+	enableCallSite(interceptor)
 
 	removed := false
 	// used to remove the local interceptor
@@ -119,35 +156,86 @@ func addLocalInterceptor(interceptor *Interceptor) func() {
 			panic(fmt.Errorf("remove interceptor more than once"))
 		}
 		removed = true
-		var idx int = -1
-		for i, intc := range list.interceptors {
-			if intc == interceptor {
-				idx = i
-				break
-			}
-		}
-		if idx < 0 {
-			panic(fmt.Errorf("interceptor leaked"))
-		}
-		n := len(list.interceptors)
-		for i := idx; i < n-1; i++ {
-			list.interceptors[i] = list.interceptors[i+1]
-		}
-		list.interceptors = list.interceptors[:n-1]
-		if len(list.interceptors) == 0 {
-			// remove the entry from map to prevent memory leak
-			localInterceptors.Delete(key)
-		}
+		// copy because the list may be in use by a running trap
+		list.interceptors = removeInterceptor(list.interceptors, interceptor)
+		list.release(1)
+		deleteLocalListIfEmpty(key, list)
 	}
 }
 
 type interceptorList struct {
 	interceptors []*Interceptor
+	// interceptors targeting a single function
+	funcs map[funcKey][]*Interceptor
+	// number of generic functions in funcs
+	generic int
+
+	// set when the goroutine exits or ClearLocalInterceptors,
+	// interceptors are no longer counted as active
+	cleared bool
+}
+
+func (c *interceptorList) empty() bool {
+	return len(c.interceptors) == 0 && len(c.funcs) == 0
 }
 
-func clearLocalInterceptorsAndMark() {
+func (c *interceptorList) size() int {
+	n := len(c.interceptors)
+	for _, list := range c.funcs {
+		n += len(list)
+	}
+	return n
+}
+
+// release is called when n interceptors are disposed
+func (c *interceptorList) release(n int) {
+	if c.cleared || n == 0 {
+		return
+	}
+	__xgo_link_add_trap_active(-int32(n))
+}
+
+func getOrCreateLocalList() (unsafe.Pointer, *interceptorList) {
 	key := __xgo_link_getcurg()
-	localInterceptors.Delete(key)
+	list := &interceptorList{}
+	val, loaded := localInterceptors.LoadOrStore(key, list)
+	if loaded {
+		return key, val.(*interceptorList)
+	}
+	atomic.AddInt32(&localListCount, 1)
+	return key, list
+}
+
+func getLocalList() *interceptorList {
+	if atomic.LoadInt32(&localListCount) == 0 {
+		return nil
+	}
+	val, ok := localInterceptors.Load(__xgo_link_getcurg())
+	if !ok {
+		return nil
+	}
+	return val.(*interceptorList)
+}
+
+// remove the entry from map to prevent memory leak
+func deleteLocalListIfEmpty(key unsafe.Pointer, list *interceptorList) {
+	// already deleted, key may hold a new list
+	if list.cleared || !list.empty() {
+		return
+	}
+	if _, loaded := localInterceptors.LoadAndDelete(key); loaded {
+		atomic.AddInt32(&localListCount, -1)
+	}
+}
+
+func clearLocalInterceptorsAndActive() {
+	key := __xgo_link_getcurg()
+	if val, loaded := localInterceptors.LoadAndDelete(key); loaded {
+		atomic.AddInt32(&localListCount, -1)
+		list := val.(*interceptorList)
+		list.release(list.size())
+		list.cleared = true
+	}
 
-	clearTrappingMark()
+	clearActiveInterceptors()
 }
@@ -24,8 +24,36 @@ type objectWithErr struct {
 	err field
 }
 
+// lazyObject builds fields on first access, so
+// interceptors ignoring args or results cost nothing
+type lazyObject struct {
+	hasRecv  bool
+	recvName string
+	recv     interface{}
+	ptrs     []interface{}
+	names    []string
+
+	// the first ctx argument, excluded from ptrs
+	ctx field
+
+	built  bool
+	fields object
+}
+
+type lazyObjectWithErr struct {
+	lazyObject
+	err field
+}
+
+type lazyObjectWithCtx struct {
+	lazyObject
+}
+
 var _ core.Object = (object)(nil)
 var _ core.ObjectWithErr = (*objectWithErr)(nil)
+var _ core.Object = (*lazyObject)(nil)
+var _ core.ObjectWithErr = (*lazyObjectWithErr)(nil)
+var _ core.ObjectWithCtx = (*lazyObjectWithCtx)(nil)
 var _ core.Field = field{}
 
 func appendFields(obj object, ptrs []interface{}, names []string) object {
@@ -63,15 +91,84 @@ func (c *objectWithErr) GetErr() core.Field {
 	return c.err
 }
 
+func (c *lazyObject) get() object {
+	if c.built {
+		return c.fields
+	}
+	c.built = true
+	n := len(c.ptrs)
+	if c.hasRecv {
+		n++
+	}
+	fields := make(object, 0, n)
+	if c.hasRecv {
+		fields = append(fields, field{
+			name:   c.recvName,
+			valPtr: c.recv,
+		})
+	}
+	c.fields = appendFields(fields, c.ptrs, c.names)
+	return c.fields
+}
+
+func (c *lazyObject) GetField(name string) core.Field {
+	if name != "" && name == c.ctx.name {
+		return c.ctx
+	}
+	return c.get().GetField(name)
+}
+
+func (c *lazyObject) GetFieldIndex(i int) core.Field {
+	return c.get().GetFieldIndex(i)
+}
+
+func (c *lazyObject) NumField() int {
+	return len(c.ptrs) + boolToInt(c.hasRecv)
+}
+
+func (c *lazyObject) MarshalJSON() ([]byte, error) {
+	return c.get().MarshalJSON()
+}
+
+func (c *lazyObjectWithErr) GetErr() core.Field {
+	return c.err
+}
+
+func (c *lazyObjectWithCtx) GetCtx() core.Field {
+	return c.ctx
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
 func (c field) Name() string {
 	return c.name
 }
 
+// Set writes val into the variable, so args set
+// by Pre are seen by the original function body.
+// nil sets the zero value.
 func (c field) Set(val interface{}) {
-	reflect.ValueOf(c.valPtr).Elem().Set(reflect.ValueOf(val))
+	if c.valPtr == nil {
+		// e.g. arg named _
+		panic(fmt.Errorf("field %q cannot be set", c.name))
+	}
+	v := reflect.ValueOf(c.valPtr).Elem()
+	if val == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return
+	}
+	v.Set(reflect.ValueOf(val))
 }
 
 func (c field) Value() interface{} {
+	if c.valPtr == nil {
+		return nil
+	}
 	return reflect.ValueOf(c.valPtr).Elem().Interface()
 }
 
@@ -0,0 +1,119 @@
+package trap
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// registry holds global interceptors, it is never
+// modified after being published: writers copy it
+// under globalMutex and store the new one, so trap
+// reads a consistent snapshot without locking
+type registry struct {
+	interceptors []*Interceptor
+	// interceptors targeting a single function
+	funcs map[funcKey][]*Interceptor
+	// number of generic functions in funcs
+	generic int
+}
+
+var globalMutex sync.Mutex
+var globalRegistry atomic.Value // *registry
+
+var emptyRegistry = &registry{}
+
+func loadGlobals() *registry {
+	r, _ := globalRegistry.Load().(*registry)
+	if r == nil {
+		return emptyRegistry
+	}
+	return r
+}
+
+func (c *registry) empty() bool {
+	return len(c.interceptors) == 0 && len(c.funcs) == 0
+}
+
+func (c *registry) clone() *registry {
+	r := &registry{
+		interceptors: c.interceptors[:len(c.interceptors):len(c.interceptors)],
+		generic:      c.generic,
+	}
+	if len(c.funcs) > 0 {
+		r.funcs = make(map[funcKey][]*Interceptor, len(c.funcs))
+		for k, v := range c.funcs {
+			r.funcs[k] = v
+		}
+	}
+	return r
+}
+
+// addGlobal registers interceptor for all goroutines,
+// for every function if key is nil. It can be called
+// at any time, the returned func removes it.
+func addGlobal(key *funcKey, interceptor *Interceptor) func() {
+	globalMutex.Lock()
+	r := loadGlobals().clone()
+	if key == nil {
+		r.interceptors = append(r.interceptors, interceptor)
+	} else {
+		if r.funcs == nil {
+			r.funcs = make(map[funcKey][]*Interceptor, 1)
+		}
+		list := r.funcs[*key]
+		if len(list) == 0 && key.generic() {
+			r.generic++
+		}
+		r.funcs[*key] = append(list[:len(list):len(list)], interceptor)
+	}
+	globalRegistry.Store(r)
+	globalMutex.Unlock()
+	__xgo_link_add_trap_active(1)
+	enableCallSite(interceptor)
+
+	var removed int32
+	return func() {
+		if !atomic.CompareAndSwapInt32(&removed, 0, 1) {
+			panic(fmt.Errorf("remove interceptor more than once"))
+		}
+		removeGlobal(key, interceptor)
+	}
+}
+
+func removeGlobal(key *funcKey, interceptor *Interceptor) {
+	globalMutex.Lock()
+	defer globalMutex.Unlock()
+	r := loadGlobals().clone()
+	if key == nil {
+		r.interceptors = removeInterceptor(r.interceptors, interceptor)
+	} else {
+		list := removeInterceptor(r.funcs[*key], interceptor)
+		if len(list) == 0 {
+			delete(r.funcs, *key)
+			if key.generic() {
+				r.generic--
+			}
+		} else {
+			r.funcs[*key] = list
+		}
+	}
+	globalRegistry.Store(r)
+	__xgo_link_add_trap_active(-1)
+}
+
+// removeInterceptor returns a new slice without interceptor,
+// list is left untouched because it may be in use
+func removeInterceptor(list []*Interceptor, interceptor *Interceptor) []*Interceptor {
+	idx := -1
+	for i, intc := range list {
+		if intc == interceptor {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		panic(fmt.Errorf("interceptor leaked"))
+	}
+	return append(list[:idx:idx], list[idx+1:]...)
+}
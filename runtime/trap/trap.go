@@ -4,6 +4,7 @@ import (
 	"context"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"unsafe"
 
 	"github.com/xhd2015/xgo/runtime/core"
@@ -15,10 +16,15 @@ var setupOnce sync.Once
 func ensureInit() {
 	setupOnce.Do(func() {
 		__xgo_link_set_trap(trapImpl)
+		__xgo_link_set_trap_match(mayTrap)
 	})
 }
 
-func __xgo_link_set_trap(trapImpl func(pkgPath string, identityName string, generic bool, pc uintptr, recv interface{}, args []interface{}, results []interface{}) (func(), bool)) {
+func __xgo_link_set_trap_match(match func(pc uintptr) bool) {
+	panic("failed to link __xgo_link_set_trap_match")
+}
+
+func __xgo_link_set_trap(trapImpl func(pkgPath string, identityName string, generic bool, pc uintptr, callerPC uintptr, recv interface{}, args []interface{}, results []interface{}) (func(), bool)) {
 	panic("failed to link __xgo_link_set_trap")
 }
 
@@ -30,25 +36,44 @@ func __xgo_link_set_trap(trapImpl func(pkgPath string, identityName string, gene
 // sense at compile time.
 func Skip() {}
 
-var trappingMark sync.Map // <goroutine key> -> struct{}{}
+// interceptors running on each goroutine. An interceptor is not
+// applied to calls made while it is running, which prevents infinite
+// recursion, but other interceptors still see these calls: e.g. a
+// helper called by a mock is still traced, and so is an Error()
+// method called by trace to serialize a result.
+var activeInterceptors sync.Map // <goroutine key> -> *activeList
+
+// activeList is only accessed by its own goroutine
+type activeList struct {
+	list []*Interceptor
+}
 
 // link to runtime
 // xgo:notrap
-func trapImpl(pkgPath string, identityName string, generic bool, pc uintptr, recv interface{}, args []interface{}, results []interface{}) (func(), bool) {
-	dispose := setTrappingMark()
-	if dispose == nil {
+func trapImpl(pkgPath string, identityName string, generic bool, pc uintptr, callerPC uintptr, recv interface{}, args []interface{}, results []interface{}) (func(), bool) {
+	// fast path, no interceptor at all
+	globals := loadGlobals()
+	if globals.empty() && atomic.LoadInt32(&localListCount) == 0 {
 		return nil, false
 	}
-	defer dispose()
-	type intf struct {
-		_  uintptr
-		pc *uintptr
+	key := funcKey{pc: pc}
+	if generic {
+		key = funcKey{pkgPath: pkgPath, identityName: identityName}
+	}
+	interceptors := sortByPhase(getInterceptors(globals, key, isStdPkg(pkgPath)))
+	if len(interceptors) == 0 {
+		return nil, false
 	}
-	interceptors := GetAllInterceptors()
+	active := getActiveList()
+	interceptors = active.exclude(interceptors)
 	n := len(interceptors)
 	if n == 0 {
 		return nil, false
 	}
+	type intf struct {
+		_  uintptr
+		pc *uintptr
+	}
 	if false {
 		// check if the calling func is an interceptor, if so, skip
 		// UPDATE: don't do manual check
@@ -76,29 +101,37 @@ func trapImpl(pkgPath string, identityName string, generic bool, pc uintptr, rec
 		return nil, false
 	}
 
-	// TODO: set FirstArgCtx and LastResultErr
-	req := make(object, 0, len(args))
-	result := make(object, 0, len(results))
+	// fields are built when first accessed
+	argsObj := lazyObject{
+		ptrs:  args,
+		names: f.ArgNames,
+	}
 	if f.RecvType != "" {
-		req = append(req, field{
-			name:   f.RecvName,
-			valPtr: recv,
-		})
+		argsObj.hasRecv = true
+		argsObj.recvName = f.RecvName
+		argsObj.recv = recv
 	}
+	var req core.Object
 	if !f.FirstArgCtx {
-		req = appendFields(req, args, f.ArgNames)
+		req = &argsObj
 	} else {
-		argNames := f.ArgNames
-		if argNames != nil {
-			argNames = argNames[1:]
+		// ctx is not indexed, but can be got
+		// by GetCtx, or by name
+		argsObj.ctx = field{valPtr: args[0]}
+		if argsObj.names != nil {
+			argsObj.ctx.name = argsObj.names[0]
+			argsObj.names = argsObj.names[1:]
 		}
-		req = appendFields(req, args[1:], argNames)
+		argsObj.ptrs = args[1:]
+		req = &lazyObjectWithCtx{lazyObject: argsObj}
 	}
 
 	var resObject core.Object
 	if !f.LastResultErr {
-		result = appendFields(result, results, f.ResNames)
-		resObject = result
+		resObject = &lazyObject{
+			ptrs:  results,
+			names: f.ResNames,
+		}
 	} else {
 		resNames := f.ResNames
 		var errName string
@@ -106,14 +139,15 @@ func trapImpl(pkgPath string, identityName string, generic bool, pc uintptr, rec
 			errName = resNames[len(resNames)-1]
 			resNames = resNames[:len(resNames)-1]
 		}
-		errField := field{
-			name:   errName,
-			valPtr: results[len(results)-1],
-		}
-		result = appendFields(result, results[:len(results)-1], resNames)
-		resObject = &objectWithErr{
-			object: result,
-			err:    errField,
+		resObject = &lazyObjectWithErr{
+			lazyObject: lazyObject{
+				ptrs:  results[:len(results)-1],
+				names: resNames,
+			},
+			err: field{
+				name:   errName,
+				valPtr: results[len(results)-1],
+			},
 		}
 	}
 
@@ -131,40 +165,105 @@ func trapImpl(pkgPath string, identityName string, generic bool, pc uintptr, rec
 	}
 
 	// NOTE: ctx
-	var ctx context.Context
+	var pctx *context.Context
 	if f.FirstArgCtx {
 		// TODO: is *HttpRequest a *Context?
-		ctx = *(args[0].(*context.Context))
+		// nil if the ctx is named _
+		pctx, _ = args[0].(*context.Context)
 	}
-	// NOTE: context.TODO() is a constant
-	if ctx == nil {
-		ctx = context.TODO()
+
+	// call site, only for interceptors asking for it
+	var site *CallSite
+	for i := 0; i < n; i++ {
+		if interceptors[i].CallSite {
+			site = getCallSite(callerPC)
+			break
+		}
+	}
+	// set when the function or a Pre panics, for Post
+	var panicked *panicValue
+	// read ctx before each interceptor, so
+	// a ctx replaced by Pre is seen by later ones
+	getCtx := func(interceptor *Interceptor) context.Context {
+		var ctx context.Context
+		if pctx != nil {
+			ctx = *pctx
+		}
+		// NOTE: context.TODO() is a constant
+		if ctx == nil {
+			ctx = context.TODO()
+		}
+		if panicked != nil {
+			ctx = context.WithValue(ctx, panicKey, panicked)
+		}
+		if interceptor.CallSite && site != nil {
+			return context.WithValue(ctx, callSiteKey, site)
+		}
+		return ctx
 	}
 
 	abortIdx := -1
 	dataList := make([]interface{}, n)
-	for i := n - 1; i >= 0; i-- {
-		interceptor := interceptors[i]
-		if interceptor.Pre == nil {
-			continue
+	// Pre of interceptors after preIdx have returned
+	preIdx := n
+	// when a Pre fails or panics, Post of interceptors whose Pre
+	// has returned still run, so that e.g. a trace wrapping
+	// a failing mock stays balanced. Errors of these Post are
+	// dropped in favor of the original failure.
+	unwindPost := func() {
+		for i := preIdx + 1; i < n; i++ {
+			interceptor := interceptors[i]
+			if interceptor.Post == nil {
+				continue
+			}
+			active.runPost(interceptor, getCtx(interceptor), f, req, resObject, dataList[i])
 		}
-		// if
-		data, err := interceptor.Pre(ctx, f, req, resObject)
-		dataList[i] = data
-		if err != nil {
-			if err == ErrAbort {
-				abortIdx = i
-				// aborted
-				break
+	}
+	preErr := func() error {
+		done := false
+		defer func() {
+			if !done {
+				// Pre panicked or called runtime.Goexit,
+				// which continues after this
+				if e := recover(); e != nil {
+					panicked = &panicValue{v: e}
+					defer panic(e)
+				}
+				unwindPost()
 			}
-			// handle error gracefully
-			if perr != nil {
-				*perr = err
-				return nil, true
-			} else {
-				panic(err)
+		}()
+		for i := n - 1; i >= 0; i-- {
+			preIdx = i
+			interceptor := interceptors[i]
+			if interceptor.Pre == nil {
+				continue
+			}
+			data, err := active.runPre(interceptor, getCtx(interceptor), f, req, resObject)
+			dataList[i] = data
+			if err != nil {
+				done = true
+				if err == ErrAbort {
+					abortIdx = i
+					// aborted
+					return nil
+				}
+				return err
 			}
 		}
+		done = true
+		return nil
+	}()
+	if preErr != nil {
+		// handle error gracefully
+		if perr != nil {
+			// set before Post, so observers see the error
+			*perr = preErr
+			unwindPost()
+			return nil, true
+		} else {
+			unwindPost()
+			panic(preErr)
+		}
 	}
 	if abortIdx >= 0 {
 		// run Post immediately
@@ -173,7 +272,7 @@ func trapImpl(pkgPath string, identityName string, generic bool, pc uintptr, rec
 			if interceptor.Post == nil {
 				continue
 			}
-			err := interceptor.Post(ctx, f, req, resObject, dataList[i])
+			err := active.runPost(interceptor, getCtx(interceptor), f, req, resObject, dataList[i])
 			if err != nil {
 				if err == ErrAbort {
 					return nil, true
@@ -190,17 +289,20 @@ func trapImpl(pkgPath string, identityName string, generic bool, pc uintptr, rec
 	}
 
 	return func() {
-		dispose := setTrappingMark()
-		if dispose == nil {
-			return
+		// deferred by the trapped function, so it sees a panic
+		// of the body, which is raised again after Post.
+		// NOTE: before go1.21, panic(nil) cannot be told
+		// from runtime.Goexit here, and is lost
+		if e := recover(); e != nil {
+			panicked = &panicValue{v: e}
+			defer panic(e)
 		}
-		defer dispose()
 		for i := 0; i < n; i++ {
 			interceptor := interceptors[i]
 			if interceptor.Post == nil {
 				continue
 			}
-			err := interceptor.Post(ctx, f, req, resObject, dataList[i])
+			err := active.runPost(interceptor, getCtx(interceptor), f, req, resObject, dataList[i])
 			if err != nil {
 				if err == ErrAbort {
 					return
@@ -216,18 +318,90 @@ func trapImpl(pkgPath string, identityName string, generic bool, pc uintptr, rec
 	}, false
 }
 
-func setTrappingMark() func() {
+type panicKeyType struct{}
+
+var panicKey = panicKeyType{}
+
+type panicValue struct {
+	v interface{}
+}
+
+// GetPanic returns the value the trapped function panicked
+// with, ctx must be the one passed to Post. ok is false if
+// the function did not panic.
+func GetPanic(ctx context.Context) (v interface{}, ok bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	p, ok := ctx.Value(panicKey).(*panicValue)
+	if !ok {
+		return nil, false
+	}
+	return p.v, true
+}
+
+// getActiveList creates the list on first trap of the
+// goroutine, it is deleted when the goroutine exits
+func getActiveList() *activeList {
 	key := uintptr(__xgo_link_getcurg())
-	_, trapping := trappingMark.LoadOrStore(key, struct{}{})
-	if trapping {
-		return nil
+	val, ok := activeInterceptors.Load(key)
+	if !ok {
+		val, _ = activeInterceptors.LoadOrStore(key, &activeList{})
 	}
-	return func() {
-		trappingMark.Delete(key)
+	return val.(*activeList)
+}
+
+func (c *activeList) has(interceptor *Interceptor) bool {
+	for _, intc := range c.list {
+		if intc == interceptor {
+			return true
+		}
+	}
+	return false
+}
+
+// exclude removes running interceptors from list,
+// list is copied only if any of them is running
+func (c *activeList) exclude(list []*Interceptor) []*Interceptor {
+	if len(c.list) == 0 {
+		return list
 	}
+	var result []*Interceptor
+	for i, intc := range list {
+		if !c.has(intc) {
+			if result != nil {
+				result = append(result, intc)
+			}
+			continue
+		}
+		if result == nil {
+			result = make([]*Interceptor, i, len(list))
+			copy(result, list[:i])
+		}
+	}
+	if result == nil {
+		return list
+	}
+	return result
+}
+
+func (c *activeList) runPre(interceptor *Interceptor, ctx context.Context, f *core.FuncInfo, args core.Object, result core.Object) (interface{}, error) {
+	c.list = append(c.list, interceptor)
+	defer c.pop()
+	return interceptor.Pre(ctx, f, args, result)
+}
+
+func (c *activeList) runPost(interceptor *Interceptor, ctx context.Context, f *core.FuncInfo, args core.Object, result core.Object, data interface{}) error {
+	c.list = append(c.list, interceptor)
+	defer c.pop()
+	return interceptor.Post(ctx, f, args, result, data)
+}
+
+func (c *activeList) pop() {
+	c.list = c.list[:len(c.list)-1]
 }
 
-func clearTrappingMark() {
+func clearActiveInterceptors() {
 	key := uintptr(__xgo_link_getcurg())
-	trappingMark.Delete(key)
+	activeInterceptors.Delete(key)
 }
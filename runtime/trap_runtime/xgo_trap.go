@@ -6,6 +6,7 @@
 package runtime
 
 import (
+	"runtime/internal/atomic"
 	"unsafe"
 )
 
@@ -14,21 +15,72 @@ import (
 func __xgo_getcurg() unsafe.Pointer { return unsafe.Pointer(getg().m.curg) }
 
 // exported so other func can call it
-var __xgo_trap_impl func(pkgPath string, identityName string, generic bool, funcPC uintptr, recv interface{}, args []interface{}, results []interface{}) (func(), bool)
+var __xgo_trap_impl func(pkgPath string, identityName string, generic bool, funcPC uintptr, callerPC uintptr, recv interface{}, args []interface{}, results []interface{}) (func(), bool)
+
+// number of interceptors, maintained by the trap package
+var __xgo_trap_active uint32
+
+// set by the trap package, reports whether any interceptor
+// may apply to the function with the given entry pc
+var __xgo_trap_match func(pc uintptr) bool
+
+func __xgo_set_trap_match(match func(pc uintptr) bool) {
+	__xgo_trap_match = match
+}
+
+// __xgo_trap_enabled is checked before args of __xgo_trap are built,
+// so when nothing is registered, or no interceptor applies to the
+// caller, a trapped function only pays this call
+func __xgo_trap_enabled() bool {
+	if __xgo_func_cover_on() {
+		return true
+	}
+	if atomic.Load(&__xgo_trap_active) == 0 || __xgo_trap_impl == nil {
+		return false
+	}
+	if __xgo_trap_match == nil {
+		return true
+	}
+	// the caller is the trapped function
+	fn := findfunc(getcallerpc())
+	return __xgo_trap_match(fn.entry() /*>=go1.18*/)
+}
+
+func __xgo_add_trap_active(n int32) {
+	atomic.Xadd(&__xgo_trap_active, n)
+}
+
+// set once an interceptor asks for call sites,
+// before that trapped functions do not walk the stack
+var __xgo_trap_callsite uint32
+
+func __xgo_enable_trap_callsite() {
+	atomic.Store(&__xgo_trap_callsite, 1)
+}
 
 // this is so elegant that you cannot ignore it
 func __xgo_trap(pkgPath string, identityName string, generic bool, recv interface{}, args []interface{}, results []interface{}) (func(), bool) {
+	__xgo_record_hit(pkgPath, identityName)
 	if __xgo_trap_impl == nil {
 		return nil, false
 	}
 	pc := getcallerpc()
 	fn := findfunc(pc)
+	var callerPC uintptr
+	if atomic.Load(&__xgo_trap_callsite) != 0 {
+		// skip __xgo_trap and the trapped function, what
+		// remains is the return address in its caller
+		var pcs [1]uintptr
+		if callers(2, pcs[:]) > 0 {
+			callerPC = pcs[0]
+		}
+	}
 	// TODO: what about inlined func?
 	// funcName := fn.datap.funcName(fn.nameOff) // not necessary,because it is unsafe
-	return __xgo_trap_impl(pkgPath, identityName, generic, fn.entry() /*>=go1.18*/, recv, args, results)
+	return __xgo_trap_impl(pkgPath, identityName, generic, fn.entry() /*>=go1.18*/, callerPC, recv, args, results)
 }
 
-func __xgo_set_trap(trap func(pkgPath string, identityName string, generic bool, pc uintptr, recv interface{}, args []interface{}, results []interface{}) (func(), bool)) {
+func __xgo_set_trap(trap func(pkgPath string, identityName string, generic bool, pc uintptr, callerPC uintptr, recv interface{}, args []interface{}, results []interface{}) (func(), bool)) {
 	if __xgo_trap_impl != nil {
 		panic("trap already set by other packages")
 	}
@@ -50,11 +102,19 @@ type __xgo_func_info struct {
 	resNames     []string
 	firstArgCtx  bool // first argument is context.Context or sub type?
 	lastResErr   bool // last res is error or sub type?
+
+	// source position of the declaration
+	file    string
+	line    int
+	endLine int
+
+	// set once called, when func cover is on
+	hit uint32
 }
 
 var funcs []*__xgo_func_info
 
-func __xgo_register_func(pkgPath string, fn interface{}, recvTypeName string, recvPtr bool, name string, identityName string, generic bool, recvName string, argNames []string, resNames []string, firstArgCtx bool, lastResErr bool) {
+func __xgo_register_func(pkgPath string, fn interface{}, recvTypeName string, recvPtr bool, name string, identityName string, generic bool, recvName string, argNames []string, resNames []string, firstArgCtx bool, lastResErr bool, file string, line int, endLine int) {
 	// type intf struct {
 	// 	_  uintptr
 	// 	pc *uintptr
@@ -63,7 +123,7 @@ func __xgo_register_func(pkgPath string, fn interface{}, recvTypeName string, re
 	// fnVal := findfunc(*v.pc)
 	// funcName := fnVal.datap.funcName(fnVal.nameOff)
 	// println("register func:", funcName)
-	funcs = append(funcs, &__xgo_func_info{
+	info := &__xgo_func_info{
 		pkgPath:      pkgPath,
 		fn:           fn,
 		generic:      generic,
@@ -76,10 +136,17 @@ func __xgo_register_func(pkgPath string, fn interface{}, recvTypeName string, re
 		resNames:     resNames,
 		firstArgCtx:  firstArgCtx,
 		lastResErr:   lastResErr,
-	})
+		file:         file,
+		line:         line,
+		endLine:      endLine,
+	}
+	funcs = append(funcs, info)
+	if __xgo_func_cover_enabled {
+		__xgo_func_index[__xgo_func_key{pkgPath: pkgPath, identityName: identityName}] = info
+	}
 }
 
-func __xgo_for_each_func(f func(pkgPath string, recvTypeName string, recvPtr bool, name string, identityName string, generic bool, pc uintptr, fn interface{}, recvName string, argNames []string, resNames []string, firstArgCtx bool, lastResErr bool)) {
+func __xgo_for_each_func(f func(pkgPath string, recvTypeName string, recvPtr bool, name string, identityName string, generic bool, pc uintptr, fn interface{}, recvName string, argNames []string, resNames []string, firstArgCtx bool, lastResErr bool, file string, line int, endLine int)) {
 	for _, fn := range funcs {
 		var pc uintptr
 
@@ -93,7 +160,77 @@ func __xgo_for_each_func(f func(pkgPath string, recvTypeName string, recvPtr boo
 			// fnVal := findfunc(pc)
 			// funcName = fnVal.datap.funcName(fnVal.nameOff)
 		}
-		f(fn.pkgPath, fn.recvTypeName, fn.recvPtr, fn.name, fn.identityName, fn.generic, pc, fn.fn, fn.recvName, fn.argNames, fn.resNames, fn.firstArgCtx, fn.lastResErr)
+		f(fn.pkgPath, fn.recvTypeName, fn.recvPtr, fn.name, fn.identityName, fn.generic, pc, fn.fn, fn.recvName, fn.argNames, fn.resNames, fn.firstArgCtx, fn.lastResErr, fn.file, fn.line, fn.endLine)
+	}
+}
+
+// function coverage, enabled by XGO_FUNC_COVER,
+// which is set by 'xgo test --func-cover'
+type __xgo_func_key struct {
+	pkgPath      string
+	identityName string
+}
+
+// set once in schedinit, before any function is trapped
+var __xgo_func_cover_enabled bool
+
+// registered functions by key, funcs are only registered
+// during init, so once init finishes it is read without lock
+var __xgo_func_index map[__xgo_func_key]*__xgo_func_info
+var __xgo_func_index_frozen uint32
+
+// hits before init finishes, when __xgo_func_index still grows
+var __xgo_func_hits_lock mutex
+var __xgo_func_hits map[__xgo_func_key]bool
+
+// called after goenvs() in schedinit
+func __xgo_init_func_cover() {
+	__xgo_func_cover_enabled = gogetenv("XGO_FUNC_COVER") != ""
+	if __xgo_func_cover_enabled {
+		__xgo_func_index = make(map[__xgo_func_key]*__xgo_func_info)
+	}
+}
+
+func __xgo_func_cover_on() bool {
+	return __xgo_func_cover_enabled
+}
+
+// called when init finishes
+func __xgo_freeze_func_index() {
+	atomic.Store(&__xgo_func_index_frozen, 1)
+}
+
+func __xgo_record_hit(pkgPath string, identityName string) {
+	if !__xgo_func_cover_enabled {
+		return
+	}
+	key := __xgo_func_key{pkgPath: pkgPath, identityName: identityName}
+	if atomic.Load(&__xgo_func_index_frozen) != 0 {
+		// only the first call writes
+		info := __xgo_func_index[key]
+		if info != nil && atomic.Load(&info.hit) == 0 {
+			atomic.Store(&info.hit, 1)
+		}
+		return
+	}
+	lock(&__xgo_func_hits_lock)
+	if __xgo_func_hits == nil {
+		__xgo_func_hits = make(map[__xgo_func_key]bool)
+	}
+	__xgo_func_hits[key] = true
+	unlock(&__xgo_func_hits_lock)
+}
+
+func __xgo_for_each_func_cover(f func(pkgPath string, identityName string, file string, line int, endLine int, hit bool)) {
+	lock(&__xgo_func_hits_lock)
+	hits := make(map[__xgo_func_key]bool, len(__xgo_func_hits))
+	for k, v := range __xgo_func_hits {
+		hits[k] = v
+	}
+	unlock(&__xgo_func_hits_lock)
+	for _, fn := range funcs {
+		hit := atomic.Load(&fn.hit) != 0 || hits[__xgo_func_key{pkgPath: fn.pkgPath, identityName: fn.identityName}]
+		f(fn.pkgPath, fn.identityName, fn.file, fn.line, fn.endLine, hit)
 	}
 }
 
@@ -125,6 +262,61 @@ func __xgo_get_test_starts() []interface{} {
 	return __xgo_on_test_starts
 }
 
+// set by 'xgo test --deterministic-maps' via
+// -ldflags=-X=runtime.__xgo_map_seed=<seed>, so
+// it is ready before any map is created
+var __xgo_map_seed string
+
+var __xgo_map_seeded bool
+var __xgo_map_rand uint64
+
+// called right after alginit, replaces the random hash
+// keys so that map iteration order only depends on the
+// seed and the operations on the map
+func __xgo_init_map_seed() {
+	if __xgo_map_seed == "" {
+		return
+	}
+	n, ok := atoi(__xgo_map_seed)
+	if !ok {
+		print("xgo: invalid map seed: ", __xgo_map_seed, "\n")
+		throw("xgo: invalid map seed")
+	}
+	x := uint64(n)
+	for i := range hashkey {
+		hashkey[i] = uintptr(__xgo_map_next(&x)) | 1
+	}
+	for i := range aeskeysched {
+		aeskeysched[i] = byte(__xgo_map_next(&x))
+	}
+	__xgo_map_rand = __xgo_map_next(&x)
+	__xgo_map_seeded = true
+}
+
+// splitmix64
+func __xgo_map_next(x *uint64) uint64 {
+	*x += 0x9e3779b97f4a7c15
+	z := *x
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+func __xgo_map_hash0(hash0 uint32) uint32 {
+	if __xgo_map_seeded {
+		return uint32(__xgo_map_rand)
+	}
+	return hash0
+}
+
+// start of map iteration
+func __xgo_map_iter_start(r uintptr) uintptr {
+	if __xgo_map_seeded {
+		return uintptr(__xgo_map_rand >> 32)
+	}
+	return r
+}
+
 // func GetFuncs_Requires_Xgo() []interface{} {
 // 	return funcs
 // }
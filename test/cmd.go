@@ -2,6 +2,7 @@ package test
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"strings"
@@ -26,6 +27,8 @@ type options struct {
 	env    []string
 
 	noPipeStderr bool
+	// receives stderr instead of os.Stderr
+	stderr io.Writer
 
 	init bool
 
@@ -77,7 +80,9 @@ func runXgo(args []string, opts *options) (string, error) {
 	}
 	xgoArgs = append(xgoArgs, args...)
 	cmd := exec.Command(xgoBinary, xgoArgs...)
-	if opts == nil || !opts.noPipeStderr {
+	if opts != nil && opts.stderr != nil {
+		cmd.Stderr = opts.stderr
+	} else if opts == nil || !opts.noPipeStderr {
 		cmd.Stderr = os.Stderr
 	}
 	if opts != nil && len(opts.env) > 0 {
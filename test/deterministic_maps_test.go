@@ -0,0 +1,58 @@
+package test
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+)
+
+// go test -run TestDeterministicMaps -v ./test
+func TestDeterministicMaps(t *testing.T) {
+	t.Parallel()
+	run := func(flags ...string) (output string, stderr string) {
+		var errBuf bytes.Buffer
+		args := append(flags, "./testdata/map_order")
+		output, err := buildAndRunOutputArgs(args, buildAndOutputOptions{
+			build: func(args []string) error {
+				_, err := runXgo(args, &options{stderr: &errBuf})
+				return err
+			},
+		})
+		if err != nil {
+			t.Fatalf("%s%s", getErrMsg(err), errBuf.String())
+		}
+		return output, errBuf.String()
+	}
+	first, stderr := run("--deterministic-maps=7")
+	expectSeedMsg := "xgo: deterministic maps, seed: 7, reproduce with --deterministic-maps=7\n"
+	if !bytes.Contains([]byte(stderr), []byte(expectSeedMsg)) {
+		t.Fatalf("expect stderr contains %q, actual: %q", expectSeedMsg, stderr)
+	}
+	for i := 0; i < 3; i++ {
+		output, _ := run("--deterministic-maps=7")
+		if output != first {
+			t.Fatalf("expect same map order with the same seed, first:\n%s\nactual:\n%s", first, output)
+		}
+	}
+
+	// 100 keys in the same order by chance is unlikely
+	other, _ := run("--deterministic-maps=8")
+	if other == first {
+		t.Fatalf("expect different map order with a different seed, actual:\n%s", other)
+	}
+	noFlag, _ := run()
+	if noFlag == first {
+		t.Fatalf("expect different map order without the flag, actual:\n%s", noFlag)
+	}
+
+	// a random seed is printed, and reproduces the order
+	randOutput, stderr := run("--deterministic-maps")
+	m := regexp.MustCompile(`xgo: deterministic maps, seed: (-?\d+), reproduce with --deterministic-maps=(-?\d+)\n`).FindStringSubmatch(stderr)
+	if m == nil || m[1] != m[2] {
+		t.Fatalf("expect seed printed to stderr, actual: %q", stderr)
+	}
+	reproduced, _ := run("--deterministic-maps=" + m[1])
+	if reproduced != randOutput {
+		t.Fatalf("expect seed %s reproduces map order, first:\n%s\nactual:\n%s", m[1], randOutput, reproduced)
+	}
+}
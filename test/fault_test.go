@@ -0,0 +1,27 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// go test -run TestFaultConfig -v ./test
+func TestFaultConfig(t *testing.T) {
+	t.Parallel()
+	tmpDir, subDir, err := tmpMergeRuntimeAndTest("./testdata/fault_config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	output, err := runXgo([]string{"-v", "--fault-config", filepath.Join(subDir, "fault.json"), "./" + filepath.Base(subDir)}, &options{
+		xgoCmd:     xgoCmd_test,
+		projectDir: tmpDir,
+	})
+	if err != nil {
+		t.Fatal(getErrMsg(err))
+	}
+	// t.Logf("%s", output)
+	expectSequence(t, output, []string{"load failed: injected by config", "PASS"})
+}
@@ -0,0 +1,65 @@
+package test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// go test -run TestFuncCover -v ./test
+func TestFuncCover(t *testing.T) {
+	t.Parallel()
+	tmpDir, subDir, err := tmpWithRuntimeGoModeAndTest("./testdata/func_cover")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	coverFile := filepath.Join(tmpDir, "cover.json")
+	output, err := runXgo([]string{"--func-cover", coverFile, "./" + filepath.Base(subDir)}, &options{
+		xgoCmd:     xgoCmd_test,
+		projectDir: tmpDir,
+	})
+	if err != nil {
+		t.Fatal(getErrMsg(err))
+	}
+	// t.Logf("%s", output)
+	expectSequence(t, output, []string{"PASS", "func coverage:", "3/4 75.0%"})
+
+	data, err := os.ReadFile(coverFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pkgs []*struct {
+		Covered int
+		Total   int
+		Funcs   []*struct {
+			Func string
+			Hit  bool
+		}
+	}
+	err = json.Unmarshal(data, &pkgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 1 {
+		t.Fatalf("expect 1 package, actual: %s", data)
+	}
+	hits := make(map[string]bool)
+	for _, fn := range pkgs[0].Funcs {
+		hits[fn.Func] = fn.Hit
+	}
+	expect := map[string]bool{
+		"Used":         true,
+		"Unused":       false,
+		"inGoroutine":  true,
+		"RunGoroutine": true,
+	}
+	for name, hit := range expect {
+		actual, ok := hits[name]
+		if !ok || actual != hit {
+			t.Fatalf("expect %s hit=%v, actual: %s", name, hit, data)
+		}
+	}
+}
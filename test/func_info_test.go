@@ -20,7 +20,7 @@ func TestFuncInfo(t *testing.T) {
 	}
 	// t.Logf("%s", output)
 
-	expectNonGeneric := "example identityName: example\nexample args: [a]\n"
+	expectNonGeneric := "example identityName: example\nexample args: [a]\nexample file: func_info.go, lines: 24-26\n"
 	if !strings.HasPrefix(output, expectNonGeneric) {
 		t.Fatalf("expect output prefix %q, actual: %q", expectNonGeneric, output)
 	}
@@ -0,0 +1,37 @@
+package test
+
+import (
+	"testing"
+)
+
+// go test -run TestOtelExport -v ./test
+func TestOtelExport(t *testing.T) {
+	t.Parallel()
+	output, err := buildWithRuntimeAndOutput("./testdata/otel", buildRuntimeOpts{
+		runEnv: []string{
+			"XGO_OTEL_OUTPUT=stdout",
+		},
+	})
+	if err != nil {
+		t.Fatal(getErrMsg(err))
+	}
+	// t.Logf("%s", output)
+
+	// spans are exported in the order they finish,
+	// so children come before their parent
+	expectLines := []string{
+		// output
+		"A\nB\nC\n",
+
+		// spans
+		`"resourceSpans"`,
+		`"scope":{"name":"github.com/xhd2015/xgo/runtime/trace/otel"`,
+		`"parentSpanId"`, `"name":"A"`,
+		`"parentSpanId"`, `"name":"C"`,
+		`"status":{"message":"C failed","code":2}`,
+		`"parentSpanId"`, `"name":"B"`,
+		`"name":"main"`,
+		`"key":"code.namespace","value":{"stringValue":"main"}`,
+	}
+	expectSequence(t, output, expectLines)
+}
@@ -0,0 +1,12 @@
+package fault_config
+
+import "errors"
+
+var ErrNotFound = errors.New("not found")
+
+func Load(key string) (string, error) {
+	if key == "" {
+		return "", ErrNotFound
+	}
+	return "value of " + key, nil
+}
@@ -0,0 +1,17 @@
+package fault_config
+
+import (
+	"testing"
+
+	// rules come from xgo test --fault-config
+	_ "github.com/xhd2015/xgo/runtime/fault"
+)
+
+func TestLoad(t *testing.T) {
+	_, err := Load("a")
+	if err != nil {
+		t.Logf("load failed: %v", err)
+		return
+	}
+	t.Logf("load succeeded")
+}
@@ -0,0 +1,25 @@
+package func_cover
+
+import "sync"
+
+func Used() int {
+	return 1
+}
+
+func Unused() int {
+	return 2
+}
+
+// only reachable from a goroutine
+func inGoroutine() {
+}
+
+func RunGoroutine() {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		inGoroutine()
+	}()
+	wg.Wait()
+}
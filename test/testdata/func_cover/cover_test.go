@@ -0,0 +1,10 @@
+package func_cover
+
+import "testing"
+
+func TestUsed(t *testing.T) {
+	if Used() != 1 {
+		t.Fatalf("expect 1")
+	}
+	RunGoroutine()
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"path/filepath"
 
 	"github.com/xhd2015/xgo/runtime/functab"
 )
@@ -15,6 +16,7 @@ func main() {
 
 	fmt.Printf("example identityName: %s\n", funcInfo.IdentityName)
 	fmt.Printf("example args: %v\n", funcInfo.ArgNames)
+	fmt.Printf("example file: %s, lines: %d-%d\n", filepath.Base(funcInfo.File), funcInfo.Line, funcInfo.EndLine)
 
 	runGeneric()
 }
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func main() {
+	m := make(map[string]int)
+	for i := 0; i < 100; i++ {
+		m[fmt.Sprintf("k%d", i)] = i
+	}
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	fmt.Println(strings.Join(keys, ","))
+
+	n := map[int]bool{1: true, 2: true, 3: true, 4: true, 5: true}
+	for k := range n {
+		fmt.Print(k, " ")
+	}
+	fmt.Println()
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/xhd2015/xgo/runtime/trace/otel"
+)
+
+func init() {
+	otel.Enable()
+}
+
+func main() {
+	A()
+	B()
+}
+
+func A() {
+	fmt.Printf("A\n")
+}
+
+func B() {
+	fmt.Printf("B\n")
+	C()
+}
+
+func C() error {
+	fmt.Printf("C\n")
+	return errors.New("C failed")
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/xhd2015/xgo/runtime/trace"
+)
+
+func init() {
+	trace.Enable()
+}
+
+type Node struct {
+	Name string
+	Next *Node
+}
+
+type SelfEmbed struct {
+	*SelfEmbed
+	Name string
+}
+
+type BadMarshal struct {
+	Value string
+}
+
+func (c *BadMarshal) MarshalJSON() ([]byte, error) {
+	panic("bad marshal")
+}
+
+func main() {
+	n := &Node{Name: "n"}
+	n.Next = n
+	Cycle(n)
+	Unsupported(func() {}, make(chan int))
+	Panicking(&BadMarshal{Value: "v"}, "ok")
+	m := map[string]interface{}{"name": "m"}
+	m["self"] = m
+	MapCycle(m)
+	e := &SelfEmbed{Name: "e"}
+	e.SelfEmbed = e
+	EmbedCycle(e)
+}
+
+func Cycle(n *Node) {
+	fmt.Printf("Cycle\n")
+}
+
+func Unsupported(fn func(), ch chan int) {
+	fmt.Printf("Unsupported\n")
+}
+
+func Panicking(b *BadMarshal, s string) {
+	fmt.Printf("Panicking\n")
+}
+
+func MapCycle(m map[string]interface{}) {
+	fmt.Printf("MapCycle\n")
+}
+
+func EmbedCycle(e *SelfEmbed) {
+	fmt.Printf("EmbedCycle\n")
+}
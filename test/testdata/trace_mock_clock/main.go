@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/xhd2015/xgo/runtime/mockclock"
+	"github.com/xhd2015/xgo/runtime/trace"
+)
+
+func init() {
+	trace.Enable()
+}
+
+func main() {
+	c := mockclock.New(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	defer c.Use()()
+	fmt.Println(Stamp())
+}
+
+// time.Now is trapped for the clock, but not traced
+func Stamp() string {
+	return time.Now().Format(time.RFC3339)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/xhd2015/xgo/runtime/trace"
+)
+
+func init() {
+	trace.Enable()
+}
+
+func main() {
+	Recover()
+	Fine()
+}
+
+func Recover() {
+	defer func() {
+		if e := recover(); e != nil {
+			fmt.Printf("recovered: %v\n", e)
+		}
+	}()
+	Explode()
+}
+
+func Explode() {
+	panic("boom")
+}
+
+func Fine() {
+	fmt.Printf("fine\n")
+}
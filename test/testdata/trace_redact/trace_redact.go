@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/xhd2015/xgo/runtime/trace"
+)
+
+func init() {
+	trace.RedactNames("ssn")
+	trace.RedactPattern(`sk-[a-z0-9]+`)
+	trace.Enable()
+}
+
+type User struct {
+	Name   string
+	SSN    string
+	APIKey string `xgo:"redact"`
+}
+
+type Config struct {
+	Tokenizer string
+	Secretary string
+	Raw       json.RawMessage
+	Data      []byte
+	Headers   map[string]string
+}
+
+type Custom struct{}
+
+func (Custom) MarshalJSON() ([]byte, error) {
+	return []byte(`{"password":"custom-pw","n":1}`), nil
+}
+
+func main() {
+	Login("alice", "s3cr3t")
+	Save(&User{Name: "alice", SSN: "123-45-6789", APIKey: "k"})
+	Configure(&Config{
+		Tokenizer: "bpe",
+		Secretary: "bob",
+		Raw:       json.RawMessage(`{"password":"hunter2"}`),
+		Data:      []byte("key sk-abc123"),
+		Headers:   map[string]string{"token": "t0k", "sk-live1": "v"},
+	}, Custom{})
+}
+
+func Login(user string, password string) {
+	fmt.Printf("Login\n")
+}
+
+func Save(u *User) {
+	fmt.Printf("Save\n")
+}
+
+func Configure(c *Config, custom Custom) {
+	fmt.Printf("Configure\n")
+}
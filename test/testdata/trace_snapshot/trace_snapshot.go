@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/xhd2015/xgo/runtime/trace"
+)
+
+func init() {
+	trace.Enable()
+}
+
+type Counter struct {
+	N int
+}
+
+func main() {
+	s := []int{1, 2}
+	Fill(s)
+	c := NewCounter()
+	c.N = 10
+	fmt.Printf("%v %d\n", s, c.N)
+}
+
+func Fill(s []int) {
+	s[0] = 100
+}
+
+func NewCounter() (c *Counter) {
+	return &Counter{N: 1}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/xhd2015/xgo/runtime/trace"
+)
+
+func init() {
+	trace.Enable()
+}
+
+// main never returns to its top frame, so events
+// are only written by Disable
+func main() {
+	A()
+	trace.Disable()
+	os.Exit(0)
+}
+
+func A() {
+	fmt.Printf("A\n")
+}
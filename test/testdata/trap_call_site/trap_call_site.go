@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/xhd2015/xgo/runtime/core"
+	"github.com/xhd2015/xgo/runtime/trap"
+)
+
+func init() {
+	trap.AddInterceptor(&trap.Interceptor{
+		CallSite: true,
+		Pre: func(ctx context.Context, f *core.FuncInfo, args core.Object, results core.Object) (interface{}, error) {
+			trap.Skip()
+			if f.Name != "greet" {
+				return nil, nil
+			}
+			site := trap.GetCallSite(ctx)
+			if site == nil {
+				return nil, fmt.Errorf("no call site")
+			}
+			var caller string
+			if site.Func != nil {
+				caller = site.Func.Name
+			}
+			fmt.Printf("greet called by %s at %s:%d\n", caller, filepath.Base(site.File), site.Line)
+			if caller == "B" {
+				// behave differently per call site
+				results.GetFieldIndex(0).Set("mocked")
+				return nil, trap.ErrAbort
+			}
+			return nil, nil
+		},
+	})
+	trap.AddInterceptor(&trap.Interceptor{
+		Pre: func(ctx context.Context, f *core.FuncInfo, args core.Object, results core.Object) (interface{}, error) {
+			trap.Skip()
+			if f.Name == "greet" && trap.GetCallSite(ctx) != nil {
+				return nil, fmt.Errorf("unexpected call site")
+			}
+			return nil, nil
+		},
+	})
+}
+
+func main() {
+	fmt.Println(A())
+	fmt.Println(B())
+}
+
+func A() string {
+	return greet()
+}
+
+func B() string {
+	return greet()
+}
+
+func greet() string {
+	return "hello"
+}
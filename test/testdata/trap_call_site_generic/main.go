@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/xhd2015/xgo/runtime/core"
+	"github.com/xhd2015/xgo/runtime/trap"
+)
+
+func init() {
+	trap.AddInterceptor(&trap.Interceptor{
+		CallSite: true,
+		Pre: func(ctx context.Context, f *core.FuncInfo, args core.Object, results core.Object) (interface{}, error) {
+			trap.Skip()
+			if f.Name != "greet" {
+				return nil, nil
+			}
+			site := trap.GetCallSite(ctx)
+			if site == nil {
+				return nil, fmt.Errorf("no call site")
+			}
+			// closures are not registered
+			caller := site.FuncName
+			if site.Func != nil {
+				caller = site.Func.Name
+			}
+			fmt.Printf("greet called by %s at %s:%d\n", caller, filepath.Base(site.File), site.Line)
+			return nil, nil
+		},
+	})
+}
+
+func main() {
+	fmt.Println(A())
+	fmt.Println(B())
+}
+
+func A() string {
+	return greet(1)
+}
+
+func B() string {
+	return wrap(func() string {
+		return greet("b")
+	})
+}
+
+func wrap(f func() string) string {
+	return f()
+}
+
+func greet[T any](v T) string {
+	return fmt.Sprintf("hello %v", v)
+}
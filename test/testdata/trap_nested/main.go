@@ -15,7 +15,9 @@ import (
 //
 // After xgo v1.0.1,xgo can check dynamically
 // whether current goroutine is inside trap, if so
-// skip it
+// skip it.
+// Now only the running interceptor itself is skipped,
+// other interceptors still see callFromTrap.
 
 func main() {
 	if os.Getenv("XGO_TEST_HAS_INSTRUMENT") != "false" {
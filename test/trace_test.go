@@ -2,6 +2,7 @@ package test
 
 import (
 	"os/exec"
+	"strings"
 	"testing"
 )
 
@@ -44,3 +45,204 @@ func TestTrace(t *testing.T) {
 	}
 	expectSequence(t, output, expectLines)
 }
+
+// go test -run TestTraceStream -v ./test
+func TestTraceStream(t *testing.T) {
+	t.Parallel()
+	output, err := buildWithRuntimeAndOutput("./testdata/trace", buildRuntimeOpts{
+		runEnv: []string{
+			"XGO_TRACE_OUTPUT=stdout",
+			"XGO_TRACE_STREAM=true",
+		},
+	})
+	if err != nil {
+		t.Fatal(getErrMsg(err))
+	}
+
+	// t.Logf("%s", output)
+	expectLines := []string{
+		`{"Kind":"begin"`,
+
+		// output, events are flushed when main exits
+		"A\nB\nC\nC\n",
+
+		`{"Kind":"enter"`, `"ID":1,`, `"IdentityName":"main"`,
+		`{"Kind":"enter"`, `"ParentID":1,`, `"IdentityName":"A"`,
+		`{"Kind":"exit"`,
+		`{"Kind":"enter"`, `"ParentID":1,`, `"IdentityName":"B"`,
+		`{"Kind":"enter"`, `"IdentityName":"C"`,
+		`{"Kind":"exit"`,
+		`{"Kind":"exit"`,
+		`{"Kind":"enter"`, `"ParentID":1,`, `"IdentityName":"C"`,
+		`{"Kind":"exit"`,
+		`{"Kind":"exit"`, `"ID":1,`,
+	}
+	expectSequence(t, output, expectLines)
+}
+
+// go test -run TestTraceStreamDisable -v ./test
+func TestTraceStreamDisable(t *testing.T) {
+	t.Parallel()
+	output, err := buildWithRuntimeAndOutput("./testdata/trace_stream_exit", buildRuntimeOpts{
+		runEnv: []string{
+			"XGO_TRACE_OUTPUT=stdout",
+			"XGO_TRACE_STREAM=true",
+		},
+	})
+	if err != nil {
+		t.Fatal(getErrMsg(err))
+	}
+	expectLines := []string{
+		`{"Kind":"begin"`,
+		"A\n",
+		`{"Kind":"enter"`, `"ID":1,`, `"IdentityName":"main"`,
+		`{"Kind":"enter"`, `"ParentID":1,`, `"IdentityName":"A"`,
+		`{"Kind":"exit"`,
+	}
+	expectSequence(t, output, expectLines)
+}
+
+// go test -run TestTraceSkipsStdFuncs -v ./test
+func TestTraceSkipsStdFuncs(t *testing.T) {
+	t.Parallel()
+	output, err := buildWithRuntimeAndOutput("./testdata/trace_mock_clock", buildRuntimeOpts{
+		xgoBuildArgs: []string{"--mock-clock"},
+		runEnv: []string{
+			"XGO_TRACE_OUTPUT=stdout",
+		},
+	})
+	if err != nil {
+		t.Fatal(getErrMsg(err))
+	}
+	expectLines := []string{
+		// mocked by the clock
+		"2024-01-01T00:00:00Z\n",
+		`"IdentityName":"main"`,
+		`"IdentityName":"Stamp"`,
+	}
+	expectSequence(t, output, expectLines)
+	if strings.Contains(output, `"Pkg":"time"`) {
+		t.Fatalf("expect time funcs not traced, actual: %s", output)
+	}
+}
+
+// go test -run TestTraceMarshalUnsupported -v ./test
+func TestTraceMarshalUnsupported(t *testing.T) {
+	t.Parallel()
+	output, err := buildWithRuntimeAndOutput("./testdata/trace_marshal", buildRuntimeOpts{
+		runEnv: []string{
+			"XGO_TRACE_OUTPUT=stdout",
+		},
+	})
+	if err != nil {
+		t.Fatal(getErrMsg(err))
+	}
+
+	// t.Logf("%s", output)
+	expectLines := []string{
+		// output
+		"Cycle\nUnsupported\nPanicking\nMapCycle\nEmbedCycle\n",
+
+		// trace
+		`"IdentityName":"Cycle"`,
+		`"Args":{"n":{"Name":"n","Next":"<cycle *main.Node>"}}`,
+		`"IdentityName":"Unsupported"`,
+		`"Args":{"fn":"<func>","ch":"<chan int>"}`,
+		`"IdentityName":"Panicking"`,
+		`"Args":{"b":"<MarshalJSON error: panic: bad marshal>","s":"ok"}`,
+		`"IdentityName":"MapCycle"`,
+		`"Args":{"m":{"name":"m","self":"<cycle map[string]interface {}>"}}`,
+		`"IdentityName":"EmbedCycle"`,
+		`"Args":{"e":{"SelfEmbed":"<cycle *main.SelfEmbed>","Name":"e"}}`,
+	}
+	expectSequence(t, output, expectLines)
+}
+
+// go test -run TestTracePanic -v ./test
+func TestTracePanic(t *testing.T) {
+	t.Parallel()
+	output, err := buildWithRuntimeAndOutput("./testdata/trace_panic", buildRuntimeOpts{
+		runEnv: []string{
+			"XGO_TRACE_OUTPUT=stdout",
+		},
+	})
+	if err != nil {
+		t.Fatal(getErrMsg(err))
+	}
+
+	// t.Logf("%s", output)
+	expectLines := []string{
+		// output, the panic still reaches recover
+		"recovered: boom\nfine\n",
+
+		// trace
+		`"IdentityName":"Recover"`,
+		`"IdentityName":"Explode"`,
+		`"Panic":true,"Error":"panic: boom"`,
+		`"IdentityName":"Fine"`,
+		`"Panic":false,"Error":""`,
+	}
+	expectSequence(t, output, expectLines)
+}
+
+// go test -run TestTraceSnapshot -v ./test
+func TestTraceSnapshot(t *testing.T) {
+	t.Parallel()
+	output, err := buildWithRuntimeAndOutput("./testdata/trace_snapshot", buildRuntimeOpts{
+		runEnv: []string{
+			"XGO_TRACE_OUTPUT=stdout",
+			"XGO_TRACE_SNAPSHOT=true",
+		},
+	})
+	if err != nil {
+		t.Fatal(getErrMsg(err))
+	}
+
+	// t.Logf("%s", output)
+	expectLines := []string{
+		// output
+		"[100 2] 10\n",
+
+		// trace records values before mutation
+		`"IdentityName":"Fill"`,
+		`"Args":{"s":[1,2]}`,
+		`"IdentityName":"NewCounter"`,
+		`"Results":{"c":{"N":1}}`,
+	}
+	expectSequence(t, output, expectLines)
+}
+
+// go test -run TestTraceRedact -v ./test
+func TestTraceRedact(t *testing.T) {
+	t.Parallel()
+	output, err := buildWithRuntimeAndOutput("./testdata/trace_redact", buildRuntimeOpts{
+		runEnv: []string{
+			"XGO_TRACE_OUTPUT=stdout",
+		},
+	})
+	if err != nil {
+		t.Fatal(getErrMsg(err))
+	}
+
+	// t.Logf("%s", output)
+	expectLines := []string{
+		// output
+		"Login\nSave\nConfigure\n",
+
+		// trace
+		`"IdentityName":"Login"`,
+		`"Args":{"user":"alice","password":"<redacted>"}`,
+		`"IdentityName":"Save"`,
+		`"Args":{"u":{"Name":"alice","SSN":"<redacted>","APIKey":"<redacted>"}}`,
+		`"IdentityName":"Configure"`,
+		// names match on word boundaries, output of MarshalJSON
+		// is redacted, []byte and map keys are checked by patterns
+		`"Args":{"c":{"Tokenizer":"bpe","Secretary":"bob","Raw":{"password":"<redacted>"},"Data":"a2V5IDxyZWRhY3RlZD4=","Headers":{"<redacted>":"v","token":"<redacted>"}},"custom":{"n":1,"password":"<redacted>"}}`,
+	}
+	expectSequence(t, output, expectLines)
+	for _, secret := range []string{"s3cr3t", "123-45-6789", "hunter2", "custom-pw", "t0k", "sk-"} {
+		if strings.Contains(output, secret) {
+			t.Fatalf("expect sensitive value %q redacted, actual: %s", secret, output)
+		}
+	}
+}
@@ -27,3 +27,34 @@ func TestTrapNestedShouldAvoidRecursive(t *testing.T) {
 	expectOut := "trap pre: hello\ncall from trap\nhello world\n"
 	testTrap(t, "./testdata/trap_nested", origExpect, expectOut)
 }
+
+// go test -run TestTrapCallSite -v ./test
+func TestTrapCallSite(t *testing.T) {
+	t.Parallel()
+	output, err := buildWithRuntimeAndOutput("./testdata/trap_call_site", buildRuntimeOpts{})
+	if err != nil {
+		t.Fatal(getErrMsg(err))
+	}
+	// t.Logf("%s", output)
+	expect := "greet called by A at trap_call_site.go:54\nhello\ngreet called by B at trap_call_site.go:58\nmocked\n"
+	if output != expect {
+		t.Fatalf("expect output %q, actual: %q", expect, output)
+	}
+
+	goVersion, err := getGoVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if goVersion.Major == 1 && goVersion.Minor < 18 {
+		return
+	}
+	// generic trapped function, called directly and from a closure
+	output, err = buildWithRuntimeAndOutput("./testdata/trap_call_site_generic", buildRuntimeOpts{})
+	if err != nil {
+		t.Fatal(getErrMsg(err))
+	}
+	expect = "greet called by A at main.go:41\nhello 1\ngreet called by main.B.func1 at main.go:46\nhello b\n"
+	if output != expect {
+		t.Fatalf("expect output %q, actual: %q", expect, output)
+	}
+}